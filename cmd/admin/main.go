@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"report-generation/config"
+	"report-generation/db/store"
+	"report-generation/reports"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+const usage = `usage:
+  admin dlq list                 list dead-lettered jobs
+  admin dlq redrive -all         move every dead-lettered job back to the job queue
+  admin dlq redrive <id>...      move the given dead-lettered jobs back to the job queue`
+
+func main() {
+	ctx := context.Background()
+	if err := run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	if len(args) < 2 || args[0] != "dlq" {
+		return errors.New(usage)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+	if err := reports.RequireSharedQueue(cfg); err != nil {
+		return err
+	}
+	db, err := store.NewPostgresDB(cfg)
+	if err != nil {
+		return err
+	}
+	dataStore := store.New(db)
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqsClient := sqs.NewFromConfig(awsConfig, func(options *sqs.Options) {
+		options.BaseEndpoint = aws.String(cfg.LocalstackEndpoint)
+	})
+
+	deadLetterQueue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSDeadLetterQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+	dlq := reports.NewDeadLetterQueue(deadLetterQueue)
+
+	switch args[1] {
+	case "list":
+		deadLetters, err := dlq.List(ctx)
+		if err != nil {
+			return err
+		}
+		printDeadLetters(deadLetters)
+		return nil
+	case "redrive":
+		flags := flag.NewFlagSet("redrive", flag.ContinueOnError)
+		all := flags.Bool("all", false, "redrive every dead-lettered job")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		if *all == (flags.NArg() > 0) {
+			return errors.New(usage)
+		}
+
+		queue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSQueue, sqsClient, dataStore.QueueStore)
+		if err != nil {
+			return err
+		}
+
+		redriven, err := dlq.Redrive(ctx, queue, dataStore.ReportsStore, flags.Args())
+		printDeadLetters(redriven)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("redrove %d job(s)\n", len(redriven))
+		return nil
+	}
+	return errors.New(usage)
+}
+
+func printDeadLetters(deadLetters []reports.DeadLetter) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE ID\tATTEMPTS\tDEAD LETTERED AT\tERROR\tBODY")
+	for _, deadLetter := range deadLetters {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			deadLetter.MessageId,
+			deadLetter.Attempts,
+			deadLetter.DeadLetteredAt.Format(time.RFC3339),
+			deadLetter.Error,
+			deadLetter.Body,
+		)
+	}
+	w.Flush()
+}
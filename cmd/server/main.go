@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"report-generation/config"
 	"report-generation/db/store"
+	"report-generation/reports"
 	"report-generation/server"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -34,6 +36,9 @@ func run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if err := reports.RequireSharedQueue(cfg); err != nil {
+		return err
+	}
 	logger := slog.New(
 		slog.NewJSONHandler(os.Stdout, nil),
 	)
@@ -61,7 +66,30 @@ func run(ctx context.Context) error {
 
 	s3PresignClient := s3.NewPresignClient(s3Client)
 
-	srv := server.New(cfg, logger, dataStore, jwtManager, sqsClient, s3PresignClient)
+	reportRegistry := reports.NewDefaultRegistry()
+
+	queue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+
+	outboxRelay := reports.NewOutboxRelay(cfg, dataStore.OutboxStore, queue, logger)
+	go func() {
+		if err := outboxRelay.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("outbox relay stopped", "error", err)
+			cancel()
+		}
+	}()
+
+	reportEvents := server.NewReportEventBroker(cfg, logger)
+	go func() {
+		if err := reportEvents.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("report events listener stopped", "error", err)
+			cancel()
+		}
+	}()
+
+	srv := server.New(cfg, logger, dataStore, jwtManager, s3Client, s3PresignClient, reportRegistry, reportEvents)
 	if err := srv.Start(ctx); err != nil {
 		return err
 	}
@@ -0,0 +1,169 @@
+// Command standalone runs the API server and the report worker in one process,
+// so they can share an in-memory queue instead of SQS or Postgres.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"report-generation/config"
+	"report-generation/db/store"
+	"report-generation/reports"
+	"report-generation/server"
+)
+
+func main() {
+	ctx := context.Background()
+	if err := run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+	if cfg.WorkerId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		cfg.WorkerId = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	logger := slog.New(
+		slog.NewJSONHandler(os.Stdout, nil),
+	)
+	workerLogger := logger.With("worker_id", cfg.WorkerId)
+	db, err := store.NewPostgresDB(cfg)
+	if err != nil {
+		return err
+	}
+	dataStore := store.New(db)
+	jwtManager := server.NewJwtManager(cfg)
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqsClient := sqs.NewFromConfig(awsConfig, func(options *sqs.Options) {
+		options.BaseEndpoint = aws.String(cfg.LocalstackEndpoint)
+	})
+
+	s3Client := s3.NewFromConfig(awsConfig, func(options *s3.Options) {
+		options.BaseEndpoint = aws.String(cfg.LocalstackS3Endpoint)
+		options.UsePathStyle = true
+	})
+
+	s3PresignClient := s3.NewPresignClient(s3Client)
+
+	reportRegistry := reports.NewDefaultRegistry()
+
+	// with the memory backend both ends get the same queue, since they share the process
+	queue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+
+	deadLetterQueue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSDeadLetterQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+
+	outboxRelay := reports.NewOutboxRelay(cfg, dataStore.OutboxStore, queue, logger)
+	go func() {
+		if err := outboxRelay.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("outbox relay stopped", "error", err)
+			cancel()
+		}
+	}()
+
+	reportEvents := server.NewReportEventBroker(cfg, logger)
+	go func() {
+		if err := reportEvents.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("report events listener stopped", "error", err)
+			cancel()
+		}
+	}()
+
+	responseCache, err := reports.NewResponseCache(cfg, dataStore.ResponseCacheStore)
+	if err != nil {
+		return err
+	}
+
+	lozClient := reports.NewLozClient(cfg, reports.NewResilientHttpClient(cfg, &http.Client{
+		Timeout: 10 * time.Second,
+	}), responseCache, workerLogger)
+
+	mailer, err := reports.NewMailer(cfg, workerLogger)
+	if err != nil {
+		return err
+	}
+
+	reportNotifier := reports.NewReportNotifier(
+		cfg,
+		mailer,
+		dataStore.Users,
+		dataStore.PreferencesStore,
+		workerLogger,
+	)
+
+	reportBuilder := reports.NewReportBuilder(cfg, dataStore.ReportsStore, lozClient, reportRegistry, s3Client, reportNotifier, workerLogger)
+
+	worker := reports.NewWorker(
+		cfg,
+		reportBuilder,
+		dataStore.ReportsStore,
+		workerLogger,
+		queue,
+		reports.NewDeadLetterQueue(deadLetterQueue),
+	)
+	go worker.StartAdmin(ctx)
+
+	reaper := reports.NewReaper(cfg, dataStore.ReportsStore, reportNotifier, workerLogger)
+	go func() {
+		if err := reaper.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			workerLogger.Error("reaper stopped", "error", err)
+		}
+	}()
+
+	webhookDispatcher := reports.NewWebhookDispatcher(cfg, dataStore.WebhookStore, reports.NewWebhookHttpClient(cfg), workerLogger)
+	go func() {
+		if err := webhookDispatcher.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			workerLogger.Error("webhook dispatcher stopped", "error", err)
+		}
+	}()
+
+	// the server and the worker stop together, whichever of them stops first
+	workerDone := make(chan error, 1)
+	go func() {
+		err := worker.Start(ctx)
+		cancel()
+		workerDone <- err
+	}()
+
+	srv := server.New(cfg, logger, dataStore, jwtManager, s3Client, s3PresignClient, reportRegistry, reportEvents)
+	err = srv.Start(ctx)
+	cancel()
+	if workerErr := <-workerDone; err == nil {
+		err = workerErr
+	}
+	return err
+}
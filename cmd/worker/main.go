@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -27,16 +30,26 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	cfg, err := config.New()
 	if err != nil {
 		return err
 	}
+	if err := reports.RequireSharedQueue(cfg); err != nil {
+		return err
+	}
+	if cfg.WorkerId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		cfg.WorkerId = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
 	logger := slog.New(
 		slog.NewJSONHandler(os.Stdout, nil),
-	)
+	).With("worker_id", cfg.WorkerId)
 	db, err := store.NewPostgresDB(cfg)
 	if err != nil {
 		return err
@@ -57,14 +70,65 @@ func run(ctx context.Context) error {
 		options.BaseEndpoint = aws.String(cfg.LocalstackEndpoint)
 	})
 
-	lozClient := reports.NewLozClient(&http.Client{
+	responseCache, err := reports.NewResponseCache(cfg, dataStore.ResponseCacheStore)
+	if err != nil {
+		return err
+	}
+
+	lozClient := reports.NewLozClient(cfg, reports.NewResilientHttpClient(cfg, &http.Client{
 		Timeout: 10 * time.Second,
-	})
+	}), responseCache, logger)
+
+	reportRegistry := reports.NewDefaultRegistry()
+
+	mailer, err := reports.NewMailer(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	reportNotifier := reports.NewReportNotifier(
+		cfg,
+		mailer,
+		dataStore.Users,
+		dataStore.PreferencesStore,
+		logger,
+	)
+
+	reportBuilder := reports.NewReportBuilder(cfg, dataStore.ReportsStore, lozClient, reportRegistry, s3Client, reportNotifier, logger)
+
+	queue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+
+	deadLetterQueue, err := reports.NewQueue(ctx, cfg, cfg.AWSSQSDeadLetterQueue, sqsClient, dataStore.QueueStore)
+	if err != nil {
+		return err
+	}
+
+	worker := reports.NewWorker(
+		cfg,
+		reportBuilder,
+		dataStore.ReportsStore,
+		logger,
+		queue,
+		reports.NewDeadLetterQueue(deadLetterQueue),
+	)
+	go worker.StartAdmin(ctx)
 
-	reportBuilder := reports.NewReportBuilder(cfg, dataStore.ReportsStore, lozClient, s3Client, logger)
+	reaper := reports.NewReaper(cfg, dataStore.ReportsStore, reportNotifier, logger)
+	go func() {
+		if err := reaper.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("reaper stopped", "error", err)
+		}
+	}()
 
-	maxConcurrency := 2
-	worker := reports.NewWorker(cfg, reportBuilder, logger, sqsClient, maxConcurrency)
+	webhookDispatcher := reports.NewWebhookDispatcher(cfg, dataStore.WebhookStore, reports.NewWebhookHttpClient(cfg), logger)
+	go func() {
+		if err := webhookDispatcher.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("webhook dispatcher stopped", "error", err)
+		}
+	}()
 
 	if err := worker.Start(ctx); err != nil {
 		return err
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cfg, err := New()
+	require.NoError(t, err)
+
+	for _, visibilityTimeout := range []time.Duration{0, 500 * time.Millisecond, 4 * time.Second, 13 * time.Hour} {
+		invalid := *cfg
+		invalid.QueueVisibilityTimeout = visibilityTimeout
+		require.ErrorContains(t, invalid.Validate(), "QUEUE_VISIBILITY_TIMEOUT", visibilityTimeout)
+	}
+
+	invalid := *cfg
+	invalid.JobTimeout = 15 * time.Minute
+	require.ErrorContains(t, invalid.Validate(), "REAPER_STUCK_AFTER")
+	invalid.ReaperStuckAfter = invalid.JobTimeout + invalid.QueueVisibilityTimeout
+	require.ErrorContains(t, invalid.Validate(), "REAPER_STUCK_AFTER")
+	invalid.ReaperStuckAfter += time.Second
+	require.NoError(t, invalid.Validate())
+}
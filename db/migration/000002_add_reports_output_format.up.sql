@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN output_format VARCHAR NOT NULL DEFAULT 'csv';
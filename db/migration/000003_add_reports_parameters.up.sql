@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN parameters JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,7 @@
+CREATE TABLE response_cache (
+    key VARCHAR PRIMARY KEY,
+    body BYTEA NOT NULL,
+    etag VARCHAR NOT NULL DEFAULT '',
+    last_modified VARCHAR NOT NULL DEFAULT '',
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
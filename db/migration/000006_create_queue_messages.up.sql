@@ -0,0 +1,11 @@
+CREATE TABLE queue_messages (
+    id BIGSERIAL PRIMARY KEY,
+    queue_name VARCHAR NOT NULL,
+    body BYTEA NOT NULL,
+    receive_count INT NOT NULL DEFAULT 0,
+    receipt_handle UUID,
+    visible_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX queue_messages_visible_idx ON queue_messages (queue_name, visible_at, id);
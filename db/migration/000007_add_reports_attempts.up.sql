@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN attempts INT NOT NULL DEFAULT 0;
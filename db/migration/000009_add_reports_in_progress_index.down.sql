@@ -0,0 +1 @@
+DROP INDEX IF EXISTS reports_in_progress_started_at_idx;
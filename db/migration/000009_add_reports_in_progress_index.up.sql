@@ -0,0 +1,2 @@
+CREATE INDEX reports_in_progress_started_at_idx ON reports (started_at)
+    WHERE completed_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS report_errors;
+
+ALTER TABLE reports DROP COLUMN IF EXISTS retry_count;
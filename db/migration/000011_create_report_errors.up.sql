@@ -0,0 +1,16 @@
+ALTER TABLE reports ADD COLUMN retry_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE report_errors (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    retry_count INT NOT NULL,
+    attempts INT NOT NULL,
+    error_message VARCHAR,
+    started_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id, report_id) REFERENCES reports (user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX report_errors_report_idx ON report_errors (user_id, report_id, id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS reports_user_created_at_idx;
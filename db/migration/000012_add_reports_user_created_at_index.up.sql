@@ -0,0 +1 @@
+CREATE INDEX reports_user_created_at_idx ON reports (user_id, created_at, id);
@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN deleted_at TIMESTAMPTZ;
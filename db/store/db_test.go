@@ -48,7 +48,7 @@ func (db TestDB) Setup(t *testing.T) func(t *testing.T) {
 }
 
 func (db TestDB) Teardown(t *testing.T) {
-	tables := []string{"users", "refresh_tokens", "reports"}
+	tables := []string{"users", "refresh_tokens", "reports", "response_cache", "outbox", "queue_messages", "report_errors", "webhooks", "webhook_deliveries", "user_preferences"}
 	_, err := db.DB.Exec(fmt.Sprintf("TRUNCATE TABLE %s;", strings.Join(tables, ",")))
 	require.NoError(t, err)
 }
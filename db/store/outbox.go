@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type OutboxStore struct {
+	db *sqlx.DB
+}
+
+func NewOutboxStore(db *sql.DB) *OutboxStore {
+	return &OutboxStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type OutboxMessage struct {
+	Id        int64           `db:"id"`
+	Payload   json.RawMessage `db:"payload"`
+	CreatedAt time.Time       `db:"created_at"`
+	SentAt    *time.Time      `db:"sent_at"`
+}
+
+// insertOutboxMessage writes a message with the given querier so callers can
+// enqueue it in the same transaction as their own writes.
+func insertOutboxMessage(ctx context.Context, q sqlx.QueryerContext, payload json.RawMessage) (*OutboxMessage, error) {
+	const query = `INSERT INTO outbox (payload) VALUES ($1) RETURNING *`
+
+	var message OutboxMessage
+	if err := sqlx.GetContext(ctx, q, &message, query, payload); err != nil {
+		return nil, fmt.Errorf("failed to insert outbox message: %w", err)
+	}
+	return &message, nil
+}
+
+func (s *OutboxStore) Enqueue(ctx context.Context, payload json.RawMessage) (*OutboxMessage, error) {
+	return insertOutboxMessage(ctx, s.db, payload)
+}
+
+// PublishPending locks up to limit unsent messages, hands each one to publish
+// and marks the ones that were published as sent. It stops at the first publish
+// error, leaving the remaining messages pending for the next call.
+func (s *OutboxStore) PublishPending(ctx context.Context, limit int, publish func(ctx context.Context, message *OutboxMessage) error) (int, error) {
+	const selectQuery = `SELECT * FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`
+	const markSentQuery = `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var messages []OutboxMessage
+	if err := tx.SelectContext(ctx, &messages, selectQuery, limit); err != nil {
+		return 0, fmt.Errorf("failed to select pending outbox messages: %w", err)
+	}
+
+	sent := 0
+	var publishErr error
+	for i := range messages {
+		if publishErr = publish(ctx, &messages[i]); publishErr != nil {
+			publishErr = fmt.Errorf("failed to publish outbox message %d: %w", messages[i].Id, publishErr)
+			break
+		}
+
+		if _, err := tx.ExecContext(ctx, markSentQuery, messages[i].Id); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox message %d as sent: %w", messages[i].Id, err)
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sent, publishErr
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxStore(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReportAndEnqueue(ctx, user.Id, "test", "csv", nil, func(report *Report) (json.RawMessage, error) {
+		return json.Marshal(map[string]string{"reportId": report.Id.String()})
+	})
+	require.NoError(t, err)
+
+	_, err = reportsStore.CreateReportAndEnqueue(ctx, user.Id, "test", "csv", nil, func(report *Report) (json.RawMessage, error) {
+		return nil, errors.New("marshal failed")
+	})
+	require.Error(t, err)
+
+	outboxStore := NewOutboxStore(testDB.DB)
+
+	sent, err := outboxStore.PublishPending(ctx, 10, func(ctx context.Context, message *OutboxMessage) error {
+		return errors.New("queue is down")
+	})
+	require.Error(t, err)
+	require.Equal(t, 0, sent)
+
+	var published []*OutboxMessage
+	sent, err = outboxStore.PublishPending(ctx, 10, func(ctx context.Context, message *OutboxMessage) error {
+		published = append(published, message)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	require.JSONEq(t, `{"reportId": "`+report.Id.String()+`"}`, string(published[0].Payload))
+
+	sent, err = outboxStore.PublishPending(ctx, 10, func(ctx context.Context, message *OutboxMessage) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, sent)
+}
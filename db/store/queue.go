@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type QueueStore struct {
+	db *sqlx.DB
+}
+
+func NewQueueStore(db *sql.DB) *QueueStore {
+	return &QueueStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type QueueMessage struct {
+	Id            int64      `db:"id"`
+	QueueName     string     `db:"queue_name"`
+	Body          []byte     `db:"body"`
+	ReceiveCount  int        `db:"receive_count"`
+	ReceiptHandle *uuid.UUID `db:"receipt_handle"`
+	VisibleAt     time.Time  `db:"visible_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+func (s *QueueStore) Send(ctx context.Context, queueName string, body []byte) (*QueueMessage, error) {
+	const query = `INSERT INTO queue_messages (queue_name, body) VALUES ($1, $2) RETURNING *`
+
+	var message QueueMessage
+	err := s.db.GetContext(ctx, &message, query, queueName, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message to queue: %s: %w", queueName, err)
+	}
+	return &message, nil
+}
+
+// Receive claims up to limit visible messages and hides them for visibilityTimeout.
+// Every receive issues a new receipt handle, so a consumer whose visibility
+// expired can no longer ack or extend the message.
+func (s *QueueStore) Receive(ctx context.Context, queueName string, limit int, visibilityTimeout time.Duration) ([]QueueMessage, error) {
+	const query = `UPDATE queue_messages
+				   SET receive_count = receive_count + 1,
+				       receipt_handle = gen_random_uuid(),
+				       visible_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond'
+				   WHERE id IN (
+				       SELECT id FROM queue_messages
+				       WHERE queue_name = $1 AND visible_at <= CURRENT_TIMESTAMP
+				       ORDER BY visible_at, id
+				       LIMIT $2
+				       FOR UPDATE SKIP LOCKED
+				   ) RETURNING *`
+
+	var messages []QueueMessage
+	err := s.db.SelectContext(ctx, &messages, query, queueName, limit, visibilityTimeout.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive messages from queue: %s: %w", queueName, err)
+	}
+	return messages, nil
+}
+
+func (s *QueueStore) Delete(ctx context.Context, id int64, receiptHandle uuid.UUID) error {
+	const query = `DELETE FROM queue_messages WHERE id = $1 AND receipt_handle = $2`
+
+	result, err := s.db.ExecContext(ctx, query, id, receiptHandle)
+	if err != nil {
+		return fmt.Errorf("failed to delete queue message: %d: %w", id, err)
+	}
+	return expectOneRow(result, id)
+}
+
+func (s *QueueStore) SetVisibility(ctx context.Context, id int64, receiptHandle uuid.UUID, timeout time.Duration) error {
+	const query = `UPDATE queue_messages
+				   SET visible_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond'
+				   WHERE id = $1 AND receipt_handle = $2`
+
+	result, err := s.db.ExecContext(ctx, query, id, receiptHandle, timeout.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to change queue message visibility: %d: %w", id, err)
+	}
+	return expectOneRow(result, id)
+}
+
+// Depth counts the messages in the queue that are visible to consumers.
+func (s *QueueStore) Depth(ctx context.Context, queueName string) (int, error) {
+	const query = `SELECT COUNT(*) FROM queue_messages WHERE queue_name = $1 AND visible_at <= CURRENT_TIMESTAMP`
+
+	var depth int
+	err := s.db.GetContext(ctx, &depth, query, queueName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages in queue: %s: %w", queueName, err)
+	}
+	return depth, nil
+}
+
+func expectOneRow(result sql.Result, id int64) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("queue message %d not found or receipt handle is stale: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueStore(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	queueStore := NewQueueStore(testDB.DB)
+
+	sent, err := queueStore.Send(ctx, "jobs", []byte(`{"id": 1}`))
+	require.NoError(t, err)
+	_, err = queueStore.Send(ctx, "other", []byte(`{"id": 2}`))
+	require.NoError(t, err)
+
+	depth, err := queueStore.Depth(ctx, "jobs")
+	require.NoError(t, err)
+	require.Equal(t, 1, depth)
+
+	messages, err := queueStore.Receive(ctx, "jobs", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, sent.Id, messages[0].Id)
+	require.Equal(t, 1, messages[0].ReceiveCount)
+	require.NotNil(t, messages[0].ReceiptHandle)
+	firstDelivery := messages[0]
+
+	// invisible until the visibility timeout passes
+	messages, err = queueStore.Receive(ctx, "jobs", 10, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+
+	depth, err = queueStore.Depth(ctx, "jobs")
+	require.NoError(t, err)
+	require.Equal(t, 0, depth)
+
+	require.NoError(t, queueStore.SetVisibility(ctx, sent.Id, *firstDelivery.ReceiptHandle, 0))
+
+	messages, err = queueStore.Receive(ctx, "jobs", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, 2, messages[0].ReceiveCount)
+	require.ErrorIs(t, queueStore.Delete(ctx, sent.Id, *firstDelivery.ReceiptHandle), sql.ErrNoRows)
+
+	require.NoError(t, queueStore.Delete(ctx, sent.Id, *messages[0].ReceiptHandle))
+	require.ErrorIs(t, queueStore.Delete(ctx, sent.Id, *messages[0].ReceiptHandle), sql.ErrNoRows)
+}
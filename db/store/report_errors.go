@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportError is a failure of an earlier run of a report, kept when the report
+// is retried.
+type ReportError struct {
+	Id           int64      `db:"id"`
+	UserId       uuid.UUID  `db:"user_id"`
+	ReportId     uuid.UUID  `db:"report_id"`
+	RetryCount   int        `db:"retry_count"`
+	Attempts     int        `db:"attempts"`
+	ErrorMessage *string    `db:"error_message"`
+	StartedAt    *time.Time `db:"started_at"`
+	FailedAt     time.Time  `db:"failed_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// RetryReport moves the failure of a failed report into its error history,
+// resets it to requested with a fresh attempt budget and writes the outbox
+// message built from it, all in one transaction. It returns the current report
+// and whether it was retried, which only happens for failed reports.
+func (s *ReportsStore) RetryReport(
+	ctx context.Context,
+	userId, id uuid.UUID,
+	message func(report *Report) (json.RawMessage, error),
+) (*Report, bool, error) {
+	const selectQuery = `SELECT * FROM reports WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL FOR UPDATE`
+	const insertErrorQuery = `INSERT INTO report_errors (user_id, report_id, retry_count, attempts, error_message, started_at, failed_at)
+							  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	const updateQuery = `UPDATE reports
+						 SET started_at = NULL,
+						     failed_at = NULL,
+						     error_message = NULL,
+						     worker_id = NULL,
+						     attempts = 0,
+						     retry_count = retry_count + 1
+						 WHERE user_id = $1 AND id = $2 RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var report Report
+	if err := tx.GetContext(ctx, &report, selectQuery, userId, id); err != nil {
+		return nil, false, fmt.Errorf("failed to get report: %w", err)
+	}
+	if report.Status() != "failed" {
+		return &report, false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, insertErrorQuery,
+		report.UserId,
+		report.Id,
+		report.RetryCount,
+		report.Attempts,
+		report.ErrorMessage,
+		report.StartedAt,
+		report.FailedAt,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert report error: %w", err)
+	}
+
+	var retried Report
+	if err := tx.GetContext(ctx, &retried, updateQuery, userId, id); err != nil {
+		return nil, false, fmt.Errorf("failed to retry report: %w", err)
+	}
+
+	payload, err := message(&retried)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to build outbox message: %w", err)
+	}
+
+	if _, err := insertOutboxMessage(ctx, tx, payload); err != nil {
+		return nil, false, err
+	}
+
+	if err := notifyReportStatus(ctx, tx, &retried); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &retried, true, nil
+}
+
+// ListReportErrors returns the error history of a report, oldest first.
+func (s *ReportsStore) ListReportErrors(ctx context.Context, userId, reportId uuid.UUID) ([]ReportError, error) {
+	const query = `SELECT * FROM report_errors WHERE user_id = $1 AND report_id = $2 ORDER BY id`
+
+	var reportErrors []ReportError
+	err := s.db.SelectContext(ctx, &reportErrors, query, userId, reportId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list report errors: %w", err)
+	}
+	return reportErrors, nil
+}
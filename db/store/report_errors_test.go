@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportsStoreRetryReport(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+
+	message := func(report *Report) (json.RawMessage, error) {
+		return json.Marshal(map[string]string{"reportId": report.Id.String()})
+	}
+
+	// only failed reports can be retried
+	current, retried, err := reportsStore.RetryReport(ctx, user.Id, report.Id, message)
+	require.NoError(t, err)
+	require.False(t, retried)
+	require.Equal(t, "requested", current.Status())
+
+	report, _, err = reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+	require.NoError(t, err)
+	failedAt := time.Now()
+	errMsg := "compendium unavailable"
+	report.FailedAt = &failedAt
+	report.ErrorMessage = &errMsg
+	report, err = reportsStore.UpdateReport(ctx, report)
+	require.NoError(t, err)
+
+	retriedReport, retried, err := reportsStore.RetryReport(ctx, user.Id, report.Id, message)
+	require.NoError(t, err)
+	require.True(t, retried)
+	require.Equal(t, "requested", retriedReport.Status())
+	require.Nil(t, retriedReport.ErrorMessage)
+	require.Equal(t, 0, retriedReport.Attempts)
+	require.Equal(t, 1, retriedReport.RetryCount)
+
+	reportErrors, err := reportsStore.ListReportErrors(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.Len(t, reportErrors, 1)
+	require.Equal(t, errMsg, *reportErrors[0].ErrorMessage)
+	require.Equal(t, 0, reportErrors[0].RetryCount)
+	require.Equal(t, 1, reportErrors[0].Attempts)
+
+	outboxStore := NewOutboxStore(testDB.DB)
+	sent, err := outboxStore.PublishPending(ctx, 10, func(ctx context.Context, message *OutboxMessage) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+
+	_, _, err = reportsStore.RetryReport(ctx, user.Id, uuid.New(), message)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReportEventsChannel is the Postgres notification channel report changes are
+// published on.
+const ReportEventsChannel = "report_events"
+
+// ReportEventProgress is the event sent while a report is being built. Every
+// other event is the status the report moved to.
+const ReportEventProgress = "progress"
+
+type ReportEvent struct {
+	UserId   uuid.UUID `json:"userId"`
+	ReportId uuid.UUID `json:"reportId"`
+	Event    string    `json:"event"`
+	Stage    string    `json:"stage,omitempty"`
+}
+
+// notifyReportEvent publishes the event with pg_notify. Sent inside a
+// transaction, it is only delivered once the transaction commits.
+func notifyReportEvent(ctx context.Context, e sqlx.ExecerContext, event ReportEvent) error {
+	const query = `SELECT pg_notify($1, $2)`
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report event: %w", err)
+	}
+	if _, err := e.ExecContext(ctx, query, ReportEventsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify report event: %w", err)
+	}
+	return nil
+}
+
+func notifyReportStatus(ctx context.Context, e sqlx.ExecerContext, report *Report) error {
+	return notifyReportEvent(ctx, e, ReportEvent{
+		UserId:   report.UserId,
+		ReportId: report.Id,
+		Event:    report.Status(),
+	})
+}
+
+// NotifyReportProgress tells listeners which stage the build of a report has
+// reached.
+func (s *ReportsStore) NotifyReportProgress(ctx context.Context, report *Report, stage string) error {
+	return notifyReportEvent(ctx, s.db, ReportEvent{
+		UserId:   report.UserId,
+		ReportId: report.Id,
+		Event:    ReportEventProgress,
+		Stage:    stage,
+	})
+}
+
+// updateAndNotify runs an update returning a single report and publishes the
+// status of the updated report in the same transaction. Errors from the update
+// itself are returned unwrapped, so callers can check for sql.ErrNoRows.
+func (s *ReportsStore) updateAndNotify(ctx context.Context, query string, args ...any) (*Report, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var report Report
+	if err := tx.GetContext(ctx, &report, query, args...); err != nil {
+		return nil, err
+	}
+
+	if err := notifyReportStatus(ctx, tx, &report); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &report, nil
+}
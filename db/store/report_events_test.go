@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportsStoreNotifiesReportEvents(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	listener := pq.NewListener(testDB.cfg.DBUrl, time.Second, time.Minute, nil)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	require.NoError(t, listener.Listen(ReportEventsChannel))
+
+	nextEvent := func() ReportEvent {
+		select {
+		case notification := <-listener.Notify:
+			require.NotNil(t, notification)
+			var event ReportEvent
+			require.NoError(t, json.Unmarshal([]byte(notification.Extra), &event))
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for report event")
+		}
+		return ReportEvent{}
+	}
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReport(ctx, user.Id, "test", "csv", nil)
+	require.NoError(t, err)
+
+	report, claimed, err := reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, ReportEvent{UserId: user.Id, ReportId: report.Id, Event: "processing"}, nextEvent())
+
+	require.NoError(t, reportsStore.NotifyReportProgress(ctx, report, "fetching"))
+	require.Equal(t, ReportEvent{UserId: user.Id, ReportId: report.Id, Event: ReportEventProgress, Stage: "fetching"}, nextEvent())
+
+	// a failure that is going to be retried is only published as requested
+	retryErrMsg := "compendium unavailable"
+	_, err = reportsStore.RequeueReport(ctx, user.Id, report.Id, false, &retryErrMsg)
+	require.NoError(t, err)
+	require.Equal(t, ReportEvent{UserId: user.Id, ReportId: report.Id, Event: "requested"}, nextEvent())
+
+	completedAt := time.Now()
+	report.CompletedAt = &completedAt
+	_, err = reportsStore.UpdateReport(ctx, report)
+	require.NoError(t, err)
+	require.Equal(t, ReportEvent{UserId: user.Id, ReportId: report.Id, Event: "completed"}, nextEvent())
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,25 +23,34 @@ func NewReportsStore(db *sql.DB) *ReportsStore {
 }
 
 type Report struct {
-	UserId               uuid.UUID  `db:"user_id"`
-	Id                   uuid.UUID  `db:"id"`
-	ReportType           string     `db:"report_type"`
-	OutputFilePath       *string    `db:"output_file_path"`
-	DownloadUrl          *string    `db:"download_url"`
-	DownloadUrlExpiresAt *time.Time `db:"download_url_expires_at"`
-	ErrorMessage         *string    `db:"error_message"`
-	CreatedAt            time.Time  `db:"created_at"`
-	StartedAt            *time.Time `db:"started_at"`
-	FailedAt             *time.Time `db:"failed_at"`
-	CompletedAt          *time.Time `db:"completed_at"`
+	UserId               uuid.UUID       `db:"user_id"`
+	Id                   uuid.UUID       `db:"id"`
+	ReportType           string          `db:"report_type"`
+	OutputFormat         string          `db:"output_format"`
+	Parameters           json.RawMessage `db:"parameters"`
+	OutputFilePath       *string         `db:"output_file_path"`
+	DownloadUrl          *string         `db:"download_url"`
+	DownloadUrlExpiresAt *time.Time      `db:"download_url_expires_at"`
+	ErrorMessage         *string         `db:"error_message"`
+	Attempts             int             `db:"attempts"`
+	WorkerId             *string         `db:"worker_id"`
+	RetryCount           int             `db:"retry_count"`
+	CreatedAt            time.Time       `db:"created_at"`
+	StartedAt            *time.Time      `db:"started_at"`
+	FailedAt             *time.Time      `db:"failed_at"`
+	CompletedAt          *time.Time      `db:"completed_at"`
+	CancelledAt          *time.Time      `db:"cancelled_at"`
+	DeletedAt            *time.Time      `db:"deleted_at"`
 }
 
 func (r *Report) IsDone() bool {
-	return r.FailedAt != nil || r.CompletedAt != nil
+	return r.FailedAt != nil || r.CompletedAt != nil || r.CancelledAt != nil
 }
 
 func (r *Report) Status() string {
 	switch {
+	case r.CancelledAt != nil:
+		return "cancelled"
 	case r.StartedAt == nil:
 		return "requested"
 	case r.StartedAt != nil && !r.IsDone():
@@ -52,11 +63,54 @@ func (r *Report) Status() string {
 	return "unknown"
 }
 
-func (s *ReportsStore) CreateReport(ctx context.Context, userId uuid.UUID, reportType string) (*Report, error) {
-	const query = `INSERT INTO reports (user_id, report_type) VALUES ($1, $2) RETURNING *`
+func (s *ReportsStore) CreateReport(ctx context.Context, userId uuid.UUID, reportType, outputFormat string, parameters json.RawMessage) (*Report, error) {
+	return insertReport(ctx, s.db, userId, reportType, outputFormat, parameters)
+}
+
+// CreateReportAndEnqueue inserts the report and the outbox message built from it
+// in one transaction, so a report is never left without a job to process it.
+func (s *ReportsStore) CreateReportAndEnqueue(
+	ctx context.Context,
+	userId uuid.UUID,
+	reportType, outputFormat string,
+	parameters json.RawMessage,
+	message func(report *Report) (json.RawMessage, error),
+) (*Report, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	report, err := insertReport(ctx, tx, userId, reportType, outputFormat, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := message(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build outbox message: %w", err)
+	}
+
+	if _, err := insertOutboxMessage(ctx, tx, payload); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return report, nil
+}
+
+func insertReport(ctx context.Context, q sqlx.QueryerContext, userId uuid.UUID, reportType, outputFormat string, parameters json.RawMessage) (*Report, error) {
+	const query = `INSERT INTO reports (user_id, report_type, output_format, parameters) VALUES ($1, $2, $3, $4) RETURNING *`
+
+	if len(parameters) == 0 {
+		parameters = json.RawMessage("{}")
+	}
 
 	var report Report
-	err := s.db.GetContext(ctx, &report, query, userId, reportType)
+	err := sqlx.GetContext(ctx, q, &report, query, userId, reportType, outputFormat, parameters)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert report: %w", err)
 	}
@@ -64,21 +118,26 @@ func (s *ReportsStore) CreateReport(ctx context.Context, userId uuid.UUID, repor
 	return &report, nil
 }
 
-func (s *ReportsStore) UpdateReport(ctx context.Context, report *Report) (*Report, error) {
-	const query = `UPDATE reports 
-				   SET report_type = $1,
-				       output_file_path = $2, 
-				       download_url = $3, 
-				       download_url_expires_at = $4, 
-				       error_message = $5, 
-				       started_at = $6, 
-				       failed_at = $7, 
-				       completed_at = $8 
-				   WHERE user_id = $9 and id = $10 RETURNING *`
+const updateReportQuery = `UPDATE reports 
+						     SET report_type = $1,
+						         output_format = $2,
+						         parameters = $3,
+						         output_file_path = $4, 
+						         download_url = $5, 
+						         download_url_expires_at = $6, 
+						         error_message = $7, 
+						         started_at = $8, 
+						         failed_at = $9, 
+						         completed_at = $10,
+						         attempts = $11,
+						         worker_id = $12
+						     WHERE user_id = $13 and id = $14 AND deleted_at IS NULL RETURNING *`
 
-	var updatedReport Report
-	err := s.db.GetContext(ctx, &updatedReport, query,
+func updateReportArgs(report *Report) []any {
+	return []any{
 		report.ReportType,
+		report.OutputFormat,
+		report.Parameters,
 		report.OutputFilePath,
 		report.DownloadUrl,
 		report.DownloadUrlExpiresAt,
@@ -86,18 +145,275 @@ func (s *ReportsStore) UpdateReport(ctx context.Context, report *Report) (*Repor
 		report.StartedAt,
 		report.FailedAt,
 		report.CompletedAt,
+		report.Attempts,
+		report.WorkerId,
 		report.UserId,
 		report.Id,
-	)
+	}
+}
+
+// UpdateReport writes every field of the report except cancelled_at, which only
+// CancelReport sets, so a build finishing concurrently cannot undo a cancellation.
+// A deleted report is not updated and sql.ErrNoRows is returned, so a build
+// cannot write an output file back after the delete cleared it. The new status
+// is published on ReportEventsChannel.
+func (s *ReportsStore) UpdateReport(ctx context.Context, report *Report) (*Report, error) {
+	updatedReport, err := s.updateAndNotify(ctx, updateReportQuery, updateReportArgs(report)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update report: %w", err)
 	}
 
+	return updatedReport, nil
+}
+
+// UpdateReportAndEnqueueWebhooks updates the report like UpdateReport and, in
+// the same transaction, queues the webhook event built from the updated report
+// for every enabled webhook of its user. event returns an empty name when
+// there is nothing to deliver.
+func (s *ReportsStore) UpdateReportAndEnqueueWebhooks(
+	ctx context.Context,
+	report *Report,
+	event func(report *Report) (string, json.RawMessage, error),
+) (*Report, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var updatedReport Report
+	if err := tx.GetContext(ctx, &updatedReport, updateReportQuery, updateReportArgs(report)...); err != nil {
+		return nil, fmt.Errorf("failed to update report: %w", err)
+	}
+
+	if err := notifyReportStatus(ctx, tx, &updatedReport); err != nil {
+		return nil, err
+	}
+
+	if err := enqueueWebhookEvent(ctx, tx, &updatedReport, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return &updatedReport, nil
 }
 
+func enqueueWebhookEvent(ctx context.Context, q sqlx.ExtContext, report *Report, event func(report *Report) (string, json.RawMessage, error)) error {
+	name, payload, err := event(report)
+	if err != nil {
+		return fmt.Errorf("failed to build webhook event: %w", err)
+	}
+	if name == "" {
+		return nil
+	}
+	_, err = insertWebhookDeliveries(ctx, q, report.UserId, report.Id, name, payload)
+	return err
+}
+
+// ClaimReport marks a requested report as started by workerId in a single
+// conditional update, so when several workers receive the same job only one of
+// them builds it. It returns the current report and whether this worker won.
+func (s *ReportsStore) ClaimReport(ctx context.Context, userId, id uuid.UUID, workerId string) (*Report, bool, error) {
+	const query = `UPDATE reports
+				   SET started_at = NOW(),
+				       worker_id = $1,
+				       attempts = attempts + 1
+				   WHERE user_id = $2 AND id = $3
+				     AND started_at IS NULL AND cancelled_at IS NULL AND deleted_at IS NULL
+				   RETURNING *`
+	// deleted reports are returned too, so their jobs are skipped rather than failed
+	const currentQuery = `SELECT * FROM reports WHERE user_id = $1 AND id = $2`
+
+	claimed, err := s.updateAndNotify(ctx, query, workerId, userId, id)
+	if err == nil {
+		return claimed, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to claim report: %w", err)
+	}
+
+	var report Report
+	if err := s.db.GetContext(ctx, &report, currentQuery, userId, id); err != nil {
+		return nil, false, fmt.Errorf("failed to get report: %w", err)
+	}
+	return &report, false, nil
+}
+
+// CancelReport marks a report that is neither done nor already cancelled as
+// cancelled. It returns the current report and whether it was cancelled.
+func (s *ReportsStore) CancelReport(ctx context.Context, userId, id uuid.UUID) (*Report, bool, error) {
+	const query = `UPDATE reports
+				   SET cancelled_at = NOW()
+				   WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL
+				     AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+				   RETURNING *`
+
+	report, err := s.updateAndNotify(ctx, query, userId, id)
+	if err == nil {
+		return report, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to cancel report: %w", err)
+	}
+
+	current, err := s.GetReportByPrimaryKey(ctx, userId, id)
+	if err != nil {
+		return nil, false, err
+	}
+	return current, false, nil
+}
+
+// IsReportCancelled reports whether the report has been cancelled or deleted.
+func (s *ReportsStore) IsReportCancelled(ctx context.Context, userId, id uuid.UUID) (bool, error) {
+	const query = `SELECT cancelled_at IS NOT NULL OR deleted_at IS NOT NULL FROM reports WHERE user_id = $1 AND id = $2`
+
+	var cancelled bool
+	err := s.db.GetContext(ctx, &cancelled, query, userId, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to check report cancellation: %w", err)
+	}
+	return cancelled, nil
+}
+
+// RequeueReport puts a report back into the requested state so the next
+// delivery of its job builds it again, keeping errorMessage as the error of
+// the attempt that failed. resetAttempts starts a fresh retry budget, which is
+// what a manual redrive wants. Only the requested status is published, so
+// subscribers never see a failure that is going to be retried.
+func (s *ReportsStore) RequeueReport(ctx context.Context, userId, id uuid.UUID, resetAttempts bool, errorMessage *string) (*Report, error) {
+	const query = `UPDATE reports
+				   SET started_at = NULL,
+				       failed_at = NULL,
+				       completed_at = NULL,
+				       error_message = $1,
+				       worker_id = NULL,
+				       attempts = CASE WHEN $2 THEN 0 ELSE attempts END
+				   WHERE user_id = $3 AND id = $4 AND deleted_at IS NULL RETURNING *`
+
+	report, err := s.updateAndNotify(ctx, query, errorMessage, resetAttempts, userId, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue report: %w", err)
+	}
+	return report, nil
+}
+
+// ListStuckReports returns reports that started before startedBefore and have
+// neither completed nor failed, oldest first.
+func (s *ReportsStore) ListStuckReports(ctx context.Context, startedBefore time.Time, limit int) ([]Report, error) {
+	const query = `SELECT * FROM reports
+				   WHERE started_at < $1 AND completed_at IS NULL AND failed_at IS NULL
+				     AND cancelled_at IS NULL AND deleted_at IS NULL
+				   ORDER BY started_at
+				   LIMIT $2`
+
+	var reports []Report
+	err := s.db.SelectContext(ctx, &reports, query, startedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stuck reports: %w", err)
+	}
+	return reports, nil
+}
+
+// FailStuckReport marks a stuck report failed and queues the webhook event
+// built from it in one transaction, unless the report has moved on since it
+// was listed. It returns whether the report was updated.
+func (s *ReportsStore) FailStuckReport(
+	ctx context.Context,
+	report *Report,
+	errorMessage string,
+	event func(report *Report) (string, json.RawMessage, error),
+) (*Report, bool, error) {
+	const query = `UPDATE reports
+				   SET failed_at = NOW(),
+				       error_message = $1
+				   WHERE user_id = $2 AND id = $3 AND started_at = $4
+				     AND completed_at IS NULL AND failed_at IS NULL
+				     AND cancelled_at IS NULL AND deleted_at IS NULL
+				   RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var failed Report
+	err = tx.GetContext(ctx, &failed, query, errorMessage, report.UserId, report.Id, report.StartedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to fail stuck report: %w", err)
+	}
+
+	if err := notifyReportStatus(ctx, tx, &failed); err != nil {
+		return nil, false, err
+	}
+
+	if err := enqueueWebhookEvent(ctx, tx, &failed, event); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &failed, true, nil
+}
+
+// RequeueStuckReport resets a stuck report to requested and writes the outbox
+// message built from it in one transaction, unless the report has moved on
+// since it was listed. It returns whether the report was requeued.
+func (s *ReportsStore) RequeueStuckReport(
+	ctx context.Context,
+	report *Report,
+	message func(report *Report) (json.RawMessage, error),
+) (*Report, bool, error) {
+	const query = `UPDATE reports
+				   SET started_at = NULL,
+				       worker_id = NULL
+				   WHERE user_id = $1 AND id = $2 AND started_at = $3
+				     AND completed_at IS NULL AND failed_at IS NULL
+				     AND cancelled_at IS NULL AND deleted_at IS NULL
+				   RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var requeued Report
+	err = tx.GetContext(ctx, &requeued, query, report.UserId, report.Id, report.StartedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to requeue stuck report: %w", err)
+	}
+
+	payload, err := message(&requeued)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to build outbox message: %w", err)
+	}
+
+	if _, err := insertOutboxMessage(ctx, tx, payload); err != nil {
+		return nil, false, err
+	}
+
+	if err := notifyReportStatus(ctx, tx, &requeued); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &requeued, true, nil
+}
+
 func (s *ReportsStore) GetReportByPrimaryKey(ctx context.Context, userId, id uuid.UUID) (*Report, error) {
-	const query = `SELECT * FROM reports WHERE user_id = $1 AND id = $2`
+	const query = `SELECT * FROM reports WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL`
 
 	var report Report
 	err := s.db.GetContext(ctx, &report, query, userId, id)
@@ -106,3 +422,74 @@ func (s *ReportsStore) GetReportByPrimaryKey(ctx context.Context, userId, id uui
 	}
 	return &report, nil
 }
+
+// DeleteReport soft-deletes a report and cancels it if it is still pending or
+// processing. Deleting an already deleted report returns it unchanged, so
+// callers can retry cleaning up its output file.
+func (s *ReportsStore) DeleteReport(ctx context.Context, userId, id uuid.UUID) (*Report, error) {
+	const query = `UPDATE reports
+				   SET deleted_at = COALESCE(deleted_at, NOW()),
+				       cancelled_at = CASE
+				           WHEN completed_at IS NULL AND failed_at IS NULL THEN COALESCE(cancelled_at, NOW())
+				           ELSE cancelled_at
+				       END
+				   WHERE user_id = $1 AND id = $2 RETURNING *`
+
+	report, err := s.updateAndNotify(ctx, query, userId, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete report: %w", err)
+	}
+	return report, nil
+}
+
+// DeleteReportsOlderThan soft-deletes the user's reports created before
+// createdBefore. It returns the reports it deleted along with earlier deleted
+// ones whose output file has not been removed yet.
+func (s *ReportsStore) DeleteReportsOlderThan(ctx context.Context, userId uuid.UUID, createdBefore time.Time) ([]Report, error) {
+	const query = `UPDATE reports
+				   SET deleted_at = COALESCE(deleted_at, NOW()),
+				       cancelled_at = CASE
+				           WHEN completed_at IS NULL AND failed_at IS NULL THEN COALESCE(cancelled_at, NOW())
+				           ELSE cancelled_at
+				       END
+				   WHERE user_id = $1 AND created_at < $2
+				     AND (deleted_at IS NULL OR output_file_path IS NOT NULL)
+				   RETURNING *`
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var reports []Report
+	if err := tx.SelectContext(ctx, &reports, query, userId, createdBefore); err != nil {
+		return nil, fmt.Errorf("failed to delete reports: %w", err)
+	}
+
+	for i := range reports {
+		if err := notifyReportStatus(ctx, tx, &reports[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reports, nil
+}
+
+// ClearOutputFile forgets the output file of a report once it has been removed
+// from storage.
+func (s *ReportsStore) ClearOutputFile(ctx context.Context, userId, id uuid.UUID) error {
+	const query = `UPDATE reports
+				   SET output_file_path = NULL,
+				       download_url = NULL,
+				       download_url_expires_at = NULL
+				   WHERE user_id = $1 AND id = $2`
+
+	if _, err := s.db.ExecContext(ctx, query, userId, id); err != nil {
+		return fmt.Errorf("failed to clear report output file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportStatuses are the values Report.Status can return, in lifecycle order.
+var ReportStatuses = []string{"requested", "processing", "completed", "failed", "cancelled"}
+
+// reportStatusConditions mirror Report.Status in SQL.
+var reportStatusConditions = map[string]string{
+	"requested":  "(cancelled_at IS NULL AND started_at IS NULL)",
+	"processing": "(cancelled_at IS NULL AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL)",
+	"completed":  "(cancelled_at IS NULL AND started_at IS NOT NULL AND completed_at IS NOT NULL)",
+	"failed":     "(cancelled_at IS NULL AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NOT NULL)",
+	"cancelled":  "(cancelled_at IS NOT NULL)",
+}
+
+// ReportsCursor is the position of the last report of a page.
+type ReportsCursor struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Id        uuid.UUID `json:"id"`
+}
+
+type ListReportsFilter struct {
+	Statuses      []string
+	ReportType    string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Ascending lists the oldest reports first, the default is newest first.
+	Ascending bool
+	Limit     int
+	// After continues the listing from the end of a previous page.
+	After *ReportsCursor
+}
+
+// ListReports returns a page of the user's reports ordered by creation time,
+// and the cursor of the next page, which is nil on the last page.
+func (s *ReportsStore) ListReports(ctx context.Context, userId uuid.UUID, filter ListReportsFilter) ([]Report, *ReportsCursor, error) {
+	conditions := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []any{userId}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Statuses) > 0 {
+		statusConditions := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			condition, ok := reportStatusConditions[status]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown report status: %s", status)
+			}
+			statusConditions = append(statusConditions, condition)
+		}
+		conditions = append(conditions, "("+strings.Join(statusConditions, " OR ")+")")
+	}
+	if filter.ReportType != "" {
+		conditions = append(conditions, "report_type = "+arg(filter.ReportType))
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedBefore))
+	}
+
+	direction, comparison := "DESC", "<"
+	if filter.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s (%s, %s)",
+			comparison, arg(filter.After.CreatedAt), arg(filter.After.Id)))
+	}
+
+	// one extra row tells whether there is a next page
+	query := fmt.Sprintf(`SELECT * FROM reports WHERE %s ORDER BY created_at %s, id %s LIMIT %s`,
+		strings.Join(conditions, " AND "), direction, direction, arg(filter.Limit+1))
+
+	var reports []Report
+	if err := s.db.SelectContext(ctx, &reports, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+
+	if len(reports) <= filter.Limit {
+		return reports, nil, nil
+	}
+	reports = reports[:filter.Limit]
+	last := reports[len(reports)-1]
+	return reports, &ReportsCursor{CreatedAt: last.CreatedAt, Id: last.Id}, nil
+}
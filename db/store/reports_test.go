@@ -2,9 +2,12 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,11 +26,13 @@ func TestReportsStore(t *testing.T) {
 	require.NoError(t, err)
 
 	reportsStore := NewReportsStore(testDB.DB)
-	report, err := reportsStore.CreateReport(ctx, user.Id, "test")
+	report, err := reportsStore.CreateReport(ctx, user.Id, "test", "csv", nil)
 	require.NoError(t, err)
+	require.JSONEq(t, `{}`, string(report.Parameters))
 
 	require.Equal(t, user.Id, report.UserId)
 	require.Equal(t, "test", report.ReportType)
+	require.Equal(t, "csv", report.OutputFormat)
 	require.True(t, report.CreatedAt.After(now))
 
 	startedAt := report.CreatedAt.Add(time.Second)
@@ -39,6 +44,8 @@ func TestReportsStore(t *testing.T) {
 	downloadUrlExpiresAt := report.CreatedAt.Add(4 * time.Second)
 
 	report.ReportType = "ex"
+	report.OutputFormat = "json"
+	report.Parameters = json.RawMessage(`{"columns": ["name"]}`)
 	report.OutputFilePath = &outputPath
 	report.DownloadUrl = &downloadUrl
 	report.DownloadUrlExpiresAt = &downloadUrlExpiresAt
@@ -46,6 +53,7 @@ func TestReportsStore(t *testing.T) {
 	report.CompletedAt = &completedAt
 	report.FailedAt = &failedAt
 	report.ErrorMessage = &errMsg
+	report.Attempts = 2
 
 	updatedRecord, err := reportsStore.UpdateReport(ctx, report)
 	require.NoError(t, err)
@@ -54,4 +62,347 @@ func TestReportsStore(t *testing.T) {
 	gotReport, err := reportsStore.GetReportByPrimaryKey(ctx, report.UserId, report.Id)
 	require.NoError(t, err)
 	require.Equal(t, updatedRecord, gotReport)
+
+	retryErrMsg := "compendium unavailable"
+	requeued, err := reportsStore.RequeueReport(ctx, report.UserId, report.Id, false, &retryErrMsg)
+	require.NoError(t, err)
+	require.Equal(t, "requested", requeued.Status())
+	require.Equal(t, &retryErrMsg, requeued.ErrorMessage)
+	require.Equal(t, 2, requeued.Attempts)
+
+	requeued, err = reportsStore.RequeueReport(ctx, report.UserId, report.Id, true, nil)
+	require.NoError(t, err)
+	require.Nil(t, requeued.ErrorMessage)
+	require.Equal(t, 0, requeued.Attempts)
+}
+
+func TestReportsStoreClaimReport(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+
+	claimed, ok, err := reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, claimed.StartedAt)
+	require.Equal(t, "worker-1", *claimed.WorkerId)
+	require.Equal(t, 1, claimed.Attempts)
+
+	current, ok, err := reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-2")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "worker-1", *current.WorkerId)
+	require.Equal(t, 1, current.Attempts)
+
+	_, _, err = reportsStore.ClaimReport(ctx, user.Id, uuid.New(), "worker-1")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestReportsStoreStuckReports(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	for range 2 {
+		report, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+		require.NoError(t, err)
+		_, _, err = reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+		require.NoError(t, err)
+	}
+	_, err = reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+
+	listed, err := reportsStore.ListStuckReports(ctx, time.Now().Add(-time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, listed)
+
+	listed, err = reportsStore.ListStuckReports(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+
+	webhookStore := NewWebhookStore(testDB.DB)
+	webhook, err := webhookStore.CreateWebhook(ctx, user.Id, "https://example.com/hooks", "secret")
+	require.NoError(t, err)
+	failedEvent := func(report *Report) (string, json.RawMessage, error) {
+		return "report." + report.Status(), json.RawMessage(`{}`), nil
+	}
+
+	failed, ok, err := reportsStore.FailStuckReport(ctx, &listed[0], "stuck", failedEvent)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "failed", failed.Status())
+	require.Equal(t, "stuck", *failed.ErrorMessage)
+
+	deliveries, err := webhookStore.ListDeliveries(ctx, user.Id, webhook.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "report.failed", deliveries[0].Event)
+
+	// a report that moved on since it was listed is left alone
+	_, ok, err = reportsStore.FailStuckReport(ctx, &listed[0], "stuck", failedEvent)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	requeued, ok, err := reportsStore.RequeueStuckReport(ctx, &listed[1], func(report *Report) (json.RawMessage, error) {
+		return json.Marshal(map[string]string{"reportId": report.Id.String()})
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "requested", requeued.Status())
+	require.Equal(t, 1, requeued.Attempts)
+
+	outboxStore := NewOutboxStore(testDB.DB)
+	sent, err := outboxStore.PublishPending(ctx, 10, func(ctx context.Context, message *OutboxMessage) error {
+		require.JSONEq(t, `{"reportId": "`+requeued.Id.String()+`"}`, string(message.Payload))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+
+	// nor is one cancelled or deleted since it was listed
+	for range 2 {
+		report, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+		require.NoError(t, err)
+		_, _, err = reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+		require.NoError(t, err)
+	}
+	listed, err = reportsStore.ListStuckReports(ctx, time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+
+	_, _, err = reportsStore.CancelReport(ctx, user.Id, listed[0].Id)
+	require.NoError(t, err)
+	_, err = reportsStore.DeleteReport(ctx, user.Id, listed[1].Id)
+	require.NoError(t, err)
+
+	for _, report := range listed {
+		_, ok, err = reportsStore.FailStuckReport(ctx, &report, "stuck", failedEvent)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		_, ok, err = reportsStore.RequeueStuckReport(ctx, &report, func(report *Report) (json.RawMessage, error) {
+			return json.Marshal(map[string]string{"reportId": report.Id.String()})
+		})
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+
+	deliveries, err = webhookStore.ListDeliveries(ctx, user.Id, webhook.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+}
+
+func TestReportsStoreCancelReport(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+
+	cancelled, err := reportsStore.IsReportCancelled(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.False(t, cancelled)
+
+	report, ok, err := reportsStore.CancelReport(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "cancelled", report.Status())
+
+	cancelled, err = reportsStore.IsReportCancelled(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.True(t, cancelled)
+
+	// a cancelled report is never claimed
+	_, claimed, err := reportsStore.ClaimReport(ctx, user.Id, report.Id, "worker-1")
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	_, ok, err = reportsStore.CancelReport(ctx, user.Id, report.Id)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// UpdateReport leaves the cancellation in place
+	updated, err := reportsStore.UpdateReport(ctx, &Report{UserId: user.Id, Id: report.Id, ReportType: "monsters", OutputFormat: "csv", Parameters: report.Parameters})
+	require.NoError(t, err)
+	require.Equal(t, "cancelled", updated.Status())
+
+	_, _, err = reportsStore.CancelReport(ctx, user.Id, uuid.New())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestReportsStoreListReports(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+	otherUser, err := userStore.CreateUser(ctx, "other@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	var created []*Report
+	for _, reportType := range []string{"monsters", "creatures", "monsters", "treasure", "monsters"} {
+		report, err := reportsStore.CreateReport(ctx, user.Id, reportType, "csv", nil)
+		require.NoError(t, err)
+		created = append(created, report)
+	}
+	_, err = reportsStore.CreateReport(ctx, otherUser.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+	_, _, err = reportsStore.CancelReport(ctx, user.Id, created[1].Id)
+	require.NoError(t, err)
+
+	// newest first, two per page
+	var listed []Report
+	filter := ListReportsFilter{Limit: 2}
+	for {
+		page, next, err := reportsStore.ListReports(ctx, user.Id, filter)
+		require.NoError(t, err)
+		listed = append(listed, page...)
+		if next == nil {
+			break
+		}
+		filter.After = next
+	}
+	require.Len(t, listed, 5)
+	for i, report := range listed {
+		require.Equal(t, created[len(created)-1-i].Id, report.Id)
+	}
+
+	listed, next, err := reportsStore.ListReports(ctx, user.Id, ListReportsFilter{
+		ReportType: "monsters",
+		Statuses:   []string{"requested"},
+		Ascending:  true,
+		Limit:      10,
+	})
+	require.NoError(t, err)
+	require.Nil(t, next)
+	require.Len(t, listed, 3)
+	require.Equal(t, created[0].Id, listed[0].Id)
+
+	listed, _, err = reportsStore.ListReports(ctx, user.Id, ListReportsFilter{
+		Statuses: []string{"cancelled"},
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.Equal(t, created[1].Id, listed[0].Id)
+
+	createdBefore := created[2].CreatedAt
+	listed, _, err = reportsStore.ListReports(ctx, user.Id, ListReportsFilter{
+		CreatedBefore: &createdBefore,
+		Limit:         10,
+	})
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+}
+
+func TestReportsStoreDeleteReport(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	requested, err := reportsStore.CreateReport(ctx, user.Id, "monsters", "csv", nil)
+	require.NoError(t, err)
+
+	completed, err := reportsStore.CreateReport(ctx, user.Id, "treasure", "csv", nil)
+	require.NoError(t, err)
+	completed, _, err = reportsStore.ClaimReport(ctx, user.Id, completed.Id, "worker-1")
+	require.NoError(t, err)
+	outputFilePath := "/users/report.csv"
+	completedAt := time.Now()
+	completed.OutputFilePath = &outputFilePath
+	completed.CompletedAt = &completedAt
+	completed, err = reportsStore.UpdateReport(ctx, completed)
+	require.NoError(t, err)
+
+	deleted, err := reportsStore.DeleteReport(ctx, user.Id, requested.Id)
+	require.NoError(t, err)
+	require.NotNil(t, deleted.DeletedAt)
+	require.NotNil(t, deleted.CancelledAt)
+
+	// deleting again is a no-op
+	again, err := reportsStore.DeleteReport(ctx, user.Id, requested.Id)
+	require.NoError(t, err)
+	require.Equal(t, deleted.DeletedAt, again.DeletedAt)
+
+	_, err = reportsStore.GetReportByPrimaryKey(ctx, user.Id, requested.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, claimed, err := reportsStore.ClaimReport(ctx, user.Id, requested.Id, "worker-1")
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	// a build finishing after the delete cannot write its output file back
+	deleted.OutputFilePath = &outputFilePath
+	_, err = reportsStore.UpdateReport(ctx, deleted)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	bulkDeleted, err := reportsStore.DeleteReportsOlderThan(ctx, user.Id, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, bulkDeleted, 1)
+	require.Equal(t, completed.Id, bulkDeleted[0].Id)
+	require.Nil(t, bulkDeleted[0].CancelledAt)
+
+	// until its output file is cleared, the report is returned again
+	bulkDeleted, err = reportsStore.DeleteReportsOlderThan(ctx, user.Id, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, bulkDeleted, 1)
+
+	require.NoError(t, reportsStore.ClearOutputFile(ctx, user.Id, completed.Id))
+	bulkDeleted, err = reportsStore.DeleteReportsOlderThan(ctx, user.Id, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, bulkDeleted)
+
+	listed, _, err := reportsStore.ListReports(ctx, user.Id, ListReportsFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, listed)
+
+	_, err = reportsStore.DeleteReport(ctx, user.Id, uuid.New())
+	require.ErrorIs(t, err, sql.ErrNoRows)
 }
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ResponseCacheStore struct {
+	db *sqlx.DB
+}
+
+func NewResponseCacheStore(db *sql.DB) *ResponseCacheStore {
+	return &ResponseCacheStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type CachedResponse struct {
+	Key          string    `db:"key"`
+	Body         []byte    `db:"body"`
+	ETag         string    `db:"etag"`
+	LastModified string    `db:"last_modified"`
+	FetchedAt    time.Time `db:"fetched_at"`
+}
+
+func (s *ResponseCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	const query = `SELECT * FROM response_cache WHERE key = $1`
+
+	var cachedResponse CachedResponse
+	err := s.db.GetContext(ctx, &cachedResponse, query, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response: %s: %w", key, err)
+	}
+	return &cachedResponse, nil
+}
+
+func (s *ResponseCacheStore) Upsert(ctx context.Context, cachedResponse *CachedResponse) (*CachedResponse, error) {
+	const query = `INSERT INTO response_cache (key, body, etag, last_modified, fetched_at)
+				   VALUES ($1, $2, $3, $4, $5)
+				   ON CONFLICT (key) DO UPDATE
+				   SET body = EXCLUDED.body,
+				       etag = EXCLUDED.etag,
+				       last_modified = EXCLUDED.last_modified,
+				       fetched_at = EXCLUDED.fetched_at
+				   RETURNING *`
+
+	var upserted CachedResponse
+	err := s.db.GetContext(ctx, &upserted, query,
+		cachedResponse.Key,
+		cachedResponse.Body,
+		cachedResponse.ETag,
+		cachedResponse.LastModified,
+		cachedResponse.FetchedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert cached response: %s: %w", cachedResponse.Key, err)
+	}
+	return &upserted, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCacheStore(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+	responseCacheStore := NewResponseCacheStore(testDB.DB)
+
+	_, err := responseCacheStore.Get(ctx, "monsters:totk")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	fetchedAt := time.Now().UTC().Truncate(time.Microsecond)
+	created, err := responseCacheStore.Upsert(ctx, &CachedResponse{
+		Key:       "monsters:totk",
+		Body:      []byte(`{"data": []}`),
+		ETag:      `"v1"`,
+		FetchedAt: fetchedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, `"v1"`, created.ETag)
+
+	created.ETag = `"v2"`
+	created.FetchedAt = fetchedAt.Add(time.Minute)
+	updated, err := responseCacheStore.Upsert(ctx, created)
+	require.NoError(t, err)
+
+	got, err := responseCacheStore.Get(ctx, "monsters:totk")
+	require.NoError(t, err)
+	require.Equal(t, updated, got)
+	require.Equal(t, `"v2"`, got.ETag)
+	require.True(t, got.FetchedAt.Equal(fetchedAt.Add(time.Minute)))
+}
@@ -3,15 +3,25 @@ package store
 import "database/sql"
 
 type Store struct {
-	Users             *UserStore
-	RefreshTokenStore *RefreshTokenStore
-	ReportsStore      *ReportsStore
+	Users              *UserStore
+	RefreshTokenStore  *RefreshTokenStore
+	ReportsStore       *ReportsStore
+	ResponseCacheStore *ResponseCacheStore
+	OutboxStore        *OutboxStore
+	QueueStore         *QueueStore
+	WebhookStore       *WebhookStore
+	PreferencesStore   *UserPreferencesStore
 }
 
 func New(db *sql.DB) *Store {
 	return &Store{
-		Users:             NewUserStore(db),
-		RefreshTokenStore: NewRefreshTokenStore(db),
-		ReportsStore:      NewReportsStore(db),
+		Users:              NewUserStore(db),
+		RefreshTokenStore:  NewRefreshTokenStore(db),
+		ReportsStore:       NewReportsStore(db),
+		ResponseCacheStore: NewResponseCacheStore(db),
+		OutboxStore:        NewOutboxStore(db),
+		QueueStore:         NewQueueStore(db),
+		WebhookStore:       NewWebhookStore(db),
+		PreferencesStore:   NewUserPreferencesStore(db),
 	}
 }
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type UserPreferencesStore struct {
+	db *sqlx.DB
+}
+
+func NewUserPreferencesStore(db *sql.DB) *UserPreferencesStore {
+	return &UserPreferencesStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type UserPreferences struct {
+	UserId             uuid.UUID  `db:"user_id"`
+	EmailNotifications bool       `db:"email_notifications"`
+	UpdatedAt          *time.Time `db:"updated_at"`
+}
+
+// DefaultUserPreferences are the preferences of a user who never changed them.
+func DefaultUserPreferences(userId uuid.UUID) *UserPreferences {
+	return &UserPreferences{
+		UserId:             userId,
+		EmailNotifications: true,
+	}
+}
+
+// GetUserPreferences returns the user's preferences, or the defaults when they
+// have never been saved.
+func (s *UserPreferencesStore) GetUserPreferences(ctx context.Context, userId uuid.UUID) (*UserPreferences, error) {
+	const query = `SELECT * FROM user_preferences WHERE user_id = $1`
+
+	var preferences UserPreferences
+	err := s.db.GetContext(ctx, &preferences, query, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DefaultUserPreferences(userId), nil
+		}
+		return nil, fmt.Errorf("failed to get user preferences: %s: %w", userId, err)
+	}
+	return &preferences, nil
+}
+
+func (s *UserPreferencesStore) UpsertUserPreferences(ctx context.Context, preferences *UserPreferences) (*UserPreferences, error) {
+	const query = `INSERT INTO user_preferences (user_id, email_notifications)
+				   VALUES ($1, $2)
+				   ON CONFLICT (user_id) DO UPDATE
+				   SET email_notifications = EXCLUDED.email_notifications,
+				       updated_at = NOW()
+				   RETURNING *`
+
+	var upserted UserPreferences
+	err := s.db.GetContext(ctx, &upserted, query, preferences.UserId, preferences.EmailNotifications)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert user preferences: %s: %w", preferences.UserId, err)
+	}
+	return &upserted, nil
+}
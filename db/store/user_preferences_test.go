@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserPreferencesStore(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	preferencesStore := NewUserPreferencesStore(testDB.DB)
+	preferences, err := preferencesStore.GetUserPreferences(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, DefaultUserPreferences(user.Id), preferences)
+
+	preferences.EmailNotifications = false
+	upserted, err := preferencesStore.UpsertUserPreferences(ctx, preferences)
+	require.NoError(t, err)
+	require.False(t, upserted.EmailNotifications)
+	require.NotNil(t, upserted.UpdatedAt)
+
+	preferences, err = preferencesStore.GetUserPreferences(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, upserted, preferences)
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type WebhookStore struct {
+	db *sqlx.DB
+}
+
+func NewWebhookStore(db *sql.DB) *WebhookStore {
+	return &WebhookStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type Webhook struct {
+	Id        uuid.UUID `db:"id"`
+	UserId    uuid.UUID `db:"user_id"`
+	Url       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	Enabled   bool      `db:"enabled"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	Id             uuid.UUID       `db:"id"`
+	WebhookId      uuid.UUID       `db:"webhook_id"`
+	UserId         uuid.UUID       `db:"user_id"`
+	ReportId       uuid.UUID       `db:"report_id"`
+	Event          string          `db:"event"`
+	Payload        json.RawMessage `db:"payload"`
+	Attempts       int             `db:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `db:"last_attempt_at"`
+	ResponseStatus *int            `db:"response_status"`
+	LastError      *string         `db:"last_error"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+	FailedAt       *time.Time      `db:"failed_at"`
+	CreatedAt      time.Time       `db:"created_at"`
+}
+
+func (d *WebhookDelivery) Status() string {
+	switch {
+	case d.DeliveredAt != nil:
+		return "delivered"
+	case d.FailedAt != nil:
+		return "failed"
+	}
+	return "pending"
+}
+
+// PendingWebhookDelivery is a delivery claimed for sending, along with the
+// endpoint it is sent to.
+type PendingWebhookDelivery struct {
+	WebhookDelivery
+	Url    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+func (s *WebhookStore) CreateWebhook(ctx context.Context, userId uuid.UUID, url, secret string) (*Webhook, error) {
+	const query = `INSERT INTO webhooks (user_id, url, secret) VALUES ($1, $2, $3) RETURNING *`
+
+	var webhook Webhook
+	if err := s.db.GetContext(ctx, &webhook, query, userId, url, secret); err != nil {
+		return nil, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookStore) GetWebhook(ctx context.Context, userId, id uuid.UUID) (*Webhook, error) {
+	const query = `SELECT * FROM webhooks WHERE user_id = $1 AND id = $2`
+
+	var webhook Webhook
+	if err := s.db.GetContext(ctx, &webhook, query, userId, id); err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookStore) ListWebhooks(ctx context.Context, userId uuid.UUID) ([]Webhook, error) {
+	const query = `SELECT * FROM webhooks WHERE user_id = $1 ORDER BY created_at, id`
+
+	var webhooks []Webhook
+	if err := s.db.SelectContext(ctx, &webhooks, query, userId); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookStore) UpdateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	const query = `UPDATE webhooks
+				   SET url = $1,
+				       secret = $2,
+				       enabled = $3,
+				       updated_at = NOW()
+				   WHERE user_id = $4 AND id = $5 RETURNING *`
+
+	var updated Webhook
+	err := s.db.GetContext(ctx, &updated, query,
+		webhook.Url,
+		webhook.Secret,
+		webhook.Enabled,
+		webhook.UserId,
+		webhook.Id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return &updated, nil
+}
+
+// DeleteWebhook deletes the webhook along with its delivery log. It returns
+// sql.ErrNoRows when the user has no such webhook.
+func (s *WebhookStore) DeleteWebhook(ctx context.Context, userId, id uuid.UUID) error {
+	const query = `DELETE FROM webhooks WHERE user_id = $1 AND id = $2 RETURNING id`
+
+	var deleted uuid.UUID
+	if err := s.db.GetContext(ctx, &deleted, query, userId, id); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// insertWebhookDeliveries queues the event for every enabled webhook of the
+// user with the given querier, so callers can do it in the same transaction as
+// the change the event describes.
+func insertWebhookDeliveries(ctx context.Context, q sqlx.ExtContext, userId, reportId uuid.UUID, event string, payload json.RawMessage) ([]WebhookDelivery, error) {
+	const query = `INSERT INTO webhook_deliveries (webhook_id, user_id, report_id, event, payload)
+				   SELECT id, user_id, $2, $3, $4 FROM webhooks WHERE user_id = $1 AND enabled
+				   RETURNING *`
+
+	var deliveries []WebhookDelivery
+	if err := sqlx.SelectContext(ctx, q, &deliveries, query, userId, reportId, event, payload); err != nil {
+		return nil, fmt.Errorf("failed to insert webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first.
+func (s *WebhookStore) ListDeliveries(ctx context.Context, userId, webhookId uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	const query = `SELECT * FROM webhook_deliveries
+				   WHERE user_id = $1 AND webhook_id = $2
+				   ORDER BY created_at DESC, id
+				   LIMIT $3`
+
+	var deliveries []WebhookDelivery
+	if err := s.db.SelectContext(ctx, &deliveries, query, userId, webhookId, limit); err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver queues a new delivery of the payload of an earlier one, leaving
+// the earlier delivery in the log as it was.
+func (s *WebhookStore) Redeliver(ctx context.Context, userId, webhookId, id uuid.UUID) (*WebhookDelivery, error) {
+	const query = `INSERT INTO webhook_deliveries (webhook_id, user_id, report_id, event, payload)
+				   SELECT webhook_id, user_id, report_id, event, payload FROM webhook_deliveries
+				   WHERE user_id = $1 AND webhook_id = $2 AND id = $3
+				   RETURNING *`
+
+	var delivery WebhookDelivery
+	if err := s.db.GetContext(ctx, &delivery, query, userId, webhookId, id); err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// ClaimDueDeliveries locks up to limit deliveries that are due and pushes their
+// next attempt lease into the future, so another dispatcher does not send them
+// while this one is. A delivery whose dispatcher dies is retried after lease.
+// Deliveries of a disabled webhook wait until it is enabled again, those of a
+// deleted one are deleted with it.
+func (s *WebhookStore) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingWebhookDelivery, error) {
+	const query = `UPDATE webhook_deliveries d
+				   SET next_attempt_at = NOW() + make_interval(secs => $2)
+				   FROM webhooks w
+				   WHERE w.id = d.webhook_id AND w.enabled AND d.id IN (
+				       SELECT due.id FROM webhook_deliveries due
+				       JOIN webhooks ON webhooks.id = due.webhook_id AND webhooks.enabled
+				       WHERE due.delivered_at IS NULL AND due.failed_at IS NULL AND due.next_attempt_at <= NOW()
+				       ORDER BY due.next_attempt_at
+				       LIMIT $1
+				       FOR UPDATE OF due SKIP LOCKED
+				   )
+				   RETURNING d.*, w.url, w.secret`
+
+	var deliveries []PendingWebhookDelivery
+	if err := s.db.SelectContext(ctx, &deliveries, query, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// CompleteDelivery records a successful attempt.
+func (s *WebhookStore) CompleteDelivery(ctx context.Context, id uuid.UUID, responseStatus int) error {
+	const query = `UPDATE webhook_deliveries
+				   SET attempts = attempts + 1,
+				       last_attempt_at = NOW(),
+				       response_status = $1,
+				       last_error = NULL,
+				       delivered_at = NOW()
+				   WHERE id = $2`
+
+	if _, err := s.db.ExecContext(ctx, query, responseStatus, id); err != nil {
+		return fmt.Errorf("failed to complete webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// FailDeliveryAttempt records a failed attempt. The delivery is retried at
+// nextAttemptAt, or marked failed when it is nil.
+func (s *WebhookStore) FailDeliveryAttempt(ctx context.Context, id uuid.UUID, responseStatus *int, errorMessage string, nextAttemptAt *time.Time) error {
+	const query = `UPDATE webhook_deliveries
+				   SET attempts = attempts + 1,
+				       last_attempt_at = NOW(),
+				       response_status = $1,
+				       last_error = $2,
+				       next_attempt_at = COALESCE($3, next_attempt_at),
+				       failed_at = CASE WHEN $3::TIMESTAMPTZ IS NULL THEN NOW() END
+				   WHERE id = $4`
+
+	if _, err := s.db.ExecContext(ctx, query, responseStatus, errorMessage, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+	return nil
+}
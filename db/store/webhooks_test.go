@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookStore(t *testing.T) {
+	testDB := NewTestDB(t)
+	cleanup := testDB.Setup(t)
+	t.Cleanup(func() {
+		cleanup(t)
+	})
+
+	ctx := context.Background()
+
+	userStore := NewUserStore(testDB.DB)
+	user, err := userStore.CreateUser(ctx, "test@test.com", "test")
+	require.NoError(t, err)
+
+	webhookStore := NewWebhookStore(testDB.DB)
+	webhook, err := webhookStore.CreateWebhook(ctx, user.Id, "https://example.com/hooks", "secret")
+	require.NoError(t, err)
+	require.True(t, webhook.Enabled)
+
+	disabled, err := webhookStore.CreateWebhook(ctx, user.Id, "https://example.com/disabled", "secret")
+	require.NoError(t, err)
+	disabled.Enabled = false
+	disabled, err = webhookStore.UpdateWebhook(ctx, disabled)
+	require.NoError(t, err)
+	require.False(t, disabled.Enabled)
+
+	webhooks, err := webhookStore.ListWebhooks(ctx, user.Id)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+
+	reportsStore := NewReportsStore(testDB.DB)
+	report, err := reportsStore.CreateReport(ctx, user.Id, "test", "csv", nil)
+	require.NoError(t, err)
+
+	completedAt := time.Now()
+	report.StartedAt = &completedAt
+	report.CompletedAt = &completedAt
+	_, err = reportsStore.UpdateReportAndEnqueueWebhooks(ctx, report, func(report *Report) (string, json.RawMessage, error) {
+		return "report." + report.Status(), json.RawMessage(`{"status": "completed"}`), nil
+	})
+	require.NoError(t, err)
+
+	deliveries, err := webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	require.Equal(t, webhook.Id, delivery.WebhookId)
+	require.Equal(t, "report.completed", delivery.Event)
+	require.Equal(t, webhook.Url, delivery.Url)
+	require.Equal(t, webhook.Secret, delivery.Secret)
+
+	// leased deliveries are not claimed twice
+	deliveries, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	responseStatus := 500
+	nextAttemptAt := time.Now().Add(-time.Second)
+	require.NoError(t, webhookStore.FailDeliveryAttempt(ctx, delivery.Id, &responseStatus, "status 500", &nextAttemptAt))
+
+	deliveries, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, 1, deliveries[0].Attempts)
+	require.NoError(t, webhookStore.FailDeliveryAttempt(ctx, delivery.Id, nil, "connection refused", nil))
+
+	redelivered, err := webhookStore.Redeliver(ctx, user.Id, webhook.Id, delivery.Id)
+	require.NoError(t, err)
+	require.Equal(t, "pending", redelivered.Status())
+	require.JSONEq(t, `{"status": "completed"}`, string(redelivered.Payload))
+
+	deliveries, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, redelivered.Id, deliveries[0].Id)
+	require.NoError(t, webhookStore.CompleteDelivery(ctx, redelivered.Id, 204))
+
+	log, err := webhookStore.ListDeliveries(ctx, user.Id, webhook.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, log, 2)
+	statuses := map[string]int{}
+	for _, delivery := range log {
+		statuses[delivery.Status()]++
+	}
+	require.Equal(t, map[string]int{"delivered": 1, "failed": 1}, statuses)
+
+	// deliveries queued before the webhook was disabled are not sent
+	_, err = reportsStore.UpdateReportAndEnqueueWebhooks(ctx, report, func(report *Report) (string, json.RawMessage, error) {
+		return "report." + report.Status(), json.RawMessage(`{"status": "completed"}`), nil
+	})
+	require.NoError(t, err)
+	webhook.Enabled = false
+	webhook, err = webhookStore.UpdateWebhook(ctx, webhook)
+	require.NoError(t, err)
+	deliveries, err = webhookStore.ClaimDueDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	require.NoError(t, webhookStore.DeleteWebhook(ctx, user.Id, webhook.Id))
+	_, err = webhookStore.GetWebhook(ctx, user.Id, webhook.Id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, webhookStore.DeleteWebhook(ctx, user.Id, webhook.Id), sql.ErrNoRows)
+}
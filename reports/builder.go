@@ -2,13 +2,11 @@ package reports
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/csv"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -19,11 +17,18 @@ import (
 	"report-generation/db/store"
 )
 
+var (
+	ErrJobTimeout      = errors.New("report generation timed out")
+	ErrReportCancelled = errors.New("report was cancelled")
+)
+
 type ReportBuilder struct {
 	cfg          *config.Config
 	reportsStore *store.ReportsStore
 	lozClient    *LozClient
+	registry     *Registry
 	s3Client     *s3.Client
+	notifier     *ReportNotifier
 	logger       *slog.Logger
 }
 
@@ -31,87 +36,129 @@ func NewReportBuilder(
 	cfg *config.Config,
 	reportsStore *store.ReportsStore,
 	lozClient *LozClient,
+	registry *Registry,
 	s3Client *s3.Client,
+	notifier *ReportNotifier,
 	logger *slog.Logger,
 ) *ReportBuilder {
 	return &ReportBuilder{
 		cfg:          cfg,
 		reportsStore: reportsStore,
 		lozClient:    lozClient,
+		registry:     registry,
 		s3Client:     s3Client,
+		notifier:     notifier,
 		logger:       logger,
 	}
 }
 
-func (b *ReportBuilder) Build(ctx context.Context, userId, reportId uuid.UUID) (report *store.Report, err error) {
-	report, err = b.reportsStore.GetReportByPrimaryKey(ctx, userId, reportId)
+func (b *ReportBuilder) Build(ctx context.Context, message SqsMessage) (report *store.Report, err error) {
+	if b.cfg.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, b.cfg.JobTimeout, fmt.Errorf("%w after %s", ErrJobTimeout, b.cfg.JobTimeout))
+		defer cancel()
+	}
+
+	userId, reportId := message.UserId, message.ReportId
+	report, claimed, err := b.reportsStore.ClaimReport(ctx, userId, reportId, b.cfg.WorkerId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get report: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, Permanent(err)
+		}
+		return nil, err
 	}
 
-	if report.StartedAt != nil {
+	if !claimed {
+		b.logger.Info("skipping report that is already claimed or cancelled",
+			"report_id", report.Id,
+			"status", report.Status(),
+			"worker_id", report.WorkerId,
+		)
 		return report, nil
 	}
 
-	startedAt := time.Now()
-	report.StartedAt = &startedAt
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go b.watchCancellation(ctx, cancel, report)
+
+	defer func(report *store.Report) {
+		if err != nil {
+			switch cause := context.Cause(ctx); {
+			case errors.Is(cause, ErrReportCancelled):
+				b.logger.Info("stopped cancelled report", "report_id", report.Id, "user_id", report.UserId)
+				err = nil
+			case errors.Is(cause, ErrJobTimeout):
+				err = cause
+			}
+		}
+		// a failure is recorded by the worker through Requeue or Fail, once it has
+		// decided whether the job is retried
+		if err == nil {
+			b.commit(context.WithoutCancel(ctx), report)
+		}
+	}(report)
 
-	defer func() {
-		b.commit(ctx, err, report)
-	}()
+	generator, err := b.registry.Lookup(report.ReportType)
+	if err != nil {
+		return report, Permanent(err)
+	}
 
-	resp, err := b.lozClient.GetMonsters()
+	params, err := ParseParameters(report.Parameters)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get monsters from api: %w", err)
+		return report, Permanent(err)
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no monsters found")
+	game := message.Game
+	if game == "" {
+		game = params.GameOrDefault()
 	}
-	var buffer bytes.Buffer
-	gzipWriter := gzip.NewWriter(&buffer)
-	csvWriter := csv.NewWriter(gzipWriter)
 
-	header := []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"}
-	err = csvWriter.Write(header)
+	b.progress(ctx, report, "fetching")
+	rows, err := generate(ctx, generator, b.lozClient, game)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write csv header: %w", err)
-	}
-
-	for _, monster := range resp.Data {
-		csvRow := []string{
-			monster.Name,
-			strconv.Itoa(monster.Id),
-			monster.Category,
-			monster.Description,
-			monster.Image,
-			strings.Join(monster.CommonLocations, ", "),
-			strings.Join(monster.Drops, ", "),
-			strconv.FormatBool(monster.Dlc),
-		}
+		return report, err
+	}
 
-		if err := csvWriter.Write(csvRow); err != nil {
-			return nil, fmt.Errorf("failed to write csv row: %w", err)
-		}
+	dataset, err := params.Apply(&Dataset{
+		Columns: ColumnsFor(generator, game),
+		Rows:    rows,
+	})
+	if err != nil {
+		return report, Permanent(err)
 	}
 
-	csvWriter.Flush()
-	if err := csvWriter.Error(); err != nil {
-		return nil, fmt.Errorf("failed to write csv: %w", err)
+	encoder, err := b.registry.LookupEncoder(report.OutputFormat)
+	if err != nil {
+		return report, Permanent(err)
 	}
 
-	if err := gzipWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	b.progress(ctx, report, "encoding")
+	var buffer bytes.Buffer
+	if err := encoder.Encode(&buffer, dataset); err != nil {
+		return report, fmt.Errorf("failed to encode %s report: %w", report.OutputFormat, err)
 	}
 
-	key := fmt.Sprintf("/users/%s/report/%s.csv", userId, reportId)
+	b.progress(ctx, report, "uploading")
+	key := outputFileKey(userId, reportId, encoder)
 	_, err = b.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(b.cfg.AWSS3Bucket),
-		Key:    aws.String(key),
-		Body:   bytes.NewReader(buffer.Bytes()),
+		Bucket:      aws.String(b.cfg.AWSS3Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buffer.Bytes()),
+		ContentType: aws.String(encoder.ContentType()),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to put object %s: %w", key, err)
+		return report, fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+
+	// once the report is cancelled or deleted nothing would remove the file
+	cancelled, err := b.reportsStore.IsReportCancelled(ctx, userId, reportId)
+	if err != nil {
+		return report, err
+	}
+	if cancelled {
+		b.deleteOutputFile(context.WithoutCancel(ctx), report, key)
+		b.logger.Info("stopped cancelled report", "report_id", report.Id, "user_id", report.UserId)
+		return report, nil
 	}
 
 	report.OutputFilePath = &key
@@ -127,15 +174,100 @@ func (b *ReportBuilder) Build(ctx context.Context, userId, reportId uuid.UUID) (
 	return report, nil
 }
 
-func (b *ReportBuilder) commit(ctx context.Context, err error, report *store.Report) {
-	if err != nil {
-		failedAt := time.Now()
-		errMsg := err.Error()
-		report.FailedAt = &failedAt
-		report.ErrorMessage = &errMsg
+// progress tells subscribers which stage the build has reached. It is best
+// effort: a lost notification only costs them an intermediate update.
+func (b *ReportBuilder) progress(ctx context.Context, report *store.Report, stage string) {
+	if err := b.reportsStore.NotifyReportProgress(ctx, report, stage); err != nil {
+		b.logger.Warn("failed to notify report progress", "report_id", report.Id, "stage", stage, "error", err)
+	}
+}
+
+// watchCancellation polls the report until ctx is done and cancels the build
+// with ErrReportCancelled once the report has been cancelled.
+func (b *ReportBuilder) watchCancellation(ctx context.Context, cancel context.CancelCauseFunc, report *store.Report) {
+	ticker := time.NewTicker(b.cfg.CancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelled, err := b.reportsStore.IsReportCancelled(ctx, report.UserId, report.Id)
+			if err != nil {
+				if ctx.Err() == nil {
+					b.logger.Warn("failed to check report cancellation", "report_id", report.Id, "error", err)
+				}
+				continue
+			}
+			if cancelled {
+				cancel(ErrReportCancelled)
+				return
+			}
+		}
 	}
+}
 
-	if _, err := b.reportsStore.UpdateReport(ctx, report); err != nil {
+func (b *ReportBuilder) commit(ctx context.Context, report *store.Report) {
+	err := b.finish(ctx, report)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted after the last cancellation check, so the file is ours to remove
+		if report.OutputFilePath != nil {
+			b.deleteOutputFile(ctx, report, *report.OutputFilePath)
+		}
+		return
+	}
+	if err != nil {
 		b.logger.Error("failed to update report", "error", err.Error())
 	}
 }
+
+func (b *ReportBuilder) deleteOutputFile(ctx context.Context, report *store.Report, key string) {
+	_, err := b.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.cfg.AWSS3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		b.logger.Error("failed to delete output file of cancelled report", "report_id", report.Id, "path", key, "error", err)
+		return
+	}
+	b.logger.Info("deleted output file of cancelled report", "report_id", report.Id, "path", key)
+}
+
+// Requeue puts a report whose build failed with cause back into the requested
+// state in a single update, for a job the worker is going to retry.
+func (b *ReportBuilder) Requeue(ctx context.Context, report *store.Report, cause error) error {
+	errMsg := cause.Error()
+	_, err := b.reportsStore.RequeueReport(ctx, report.UserId, report.Id, false, &errMsg)
+	return err
+}
+
+// Fail marks a report failed for good, for a job the worker is not going to
+// retry.
+func (b *ReportBuilder) Fail(ctx context.Context, report *store.Report, cause error) error {
+	failedAt := time.Now()
+	errMsg := cause.Error()
+	report.FailedAt = &failedAt
+	report.ErrorMessage = &errMsg
+	if err := b.finish(ctx, report); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// finish writes a report whose outcome is final, queues its webhook event and
+// emails its user.
+func (b *ReportBuilder) finish(ctx context.Context, report *store.Report) error {
+	updatedReport, err := b.reportsStore.UpdateReportAndEnqueueWebhooks(ctx, report, NewWebhookEvent)
+	if err != nil {
+		return err
+	}
+
+	if err := b.notifier.Notify(ctx, updatedReport); err != nil {
+		b.logger.Error("failed to notify user", "report_id", report.Id, "error", err)
+	}
+	return nil
+}
+
+func outputFileKey(userId, reportId uuid.UUID, encoder Encoder) string {
+	return fmt.Sprintf("/users/%s/report/%s.%s", userId, reportId, encoder.Extension())
+}
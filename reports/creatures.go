@@ -0,0 +1,37 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+)
+
+const ReportTypeCreatures = "creatures"
+
+type creaturesGenerator struct{}
+
+func (creaturesGenerator) Columns() []string {
+	return []string{"name", "id", "category", "description", "image", "common_locations", "edible", "cooking_effect", "hearts_recovered", "drops", "dlc"}
+}
+
+func (creaturesGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	resp, err := lozClient.GetCreatures(ctx, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get creatures from api: %w", err)
+	}
+
+	return buildRows(CategoryCreatures, resp.Data, func(creature Creature) []any {
+		return []any{
+			creature.Name,
+			creature.Id,
+			creature.Category,
+			creature.Description,
+			creature.Image,
+			creature.CommonLocations,
+			creature.Edible,
+			creature.CookingEffect,
+			creature.HeartsRecovered,
+			creature.Drops,
+			creature.Dlc,
+		}
+	})
+}
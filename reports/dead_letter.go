@@ -0,0 +1,155 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"report-generation/db/store"
+)
+
+const deadLetterReceiveWaitTime = time.Second
+
+// DeadLetterMessage is what the worker puts on the dead-letter queue: the
+// original job body along with why and when it was given up on.
+type DeadLetterMessage struct {
+	Body           string    `json:"body"`
+	Error          string    `json:"error"`
+	Attempts       int       `json:"attempts"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+type DeadLetter struct {
+	MessageId string
+	DeadLetterMessage
+	message QueueMessage
+}
+
+type DeadLetterQueue struct {
+	queue Queue
+}
+
+func NewDeadLetterQueue(queue Queue) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		queue: queue,
+	}
+}
+
+func (q *DeadLetterQueue) Put(ctx context.Context, message QueueMessage, attempts int, cause error) error {
+	body, err := json.Marshal(DeadLetterMessage{
+		Body:           string(message.Body),
+		Error:          cause.Error(),
+		Attempts:       attempts,
+		DeadLetteredAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	if err := q.queue.Send(ctx, body); err != nil {
+		return fmt.Errorf("failed to send dead letter: %w", err)
+	}
+	return nil
+}
+
+// List returns every message on the dead-letter queue. Reading a queue hides
+// what was read, so the messages are made visible again before returning.
+func (q *DeadLetterQueue) List(ctx context.Context) ([]DeadLetter, error) {
+	deadLetters, err := q.receiveAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return deadLetters, q.release(ctx, deadLetters)
+}
+
+// Redrive moves dead letters back onto jobs and resets their reports to
+// requested with a fresh retry budget. An empty messageIds redrives everything.
+func (q *DeadLetterQueue) Redrive(ctx context.Context, jobs Queue, reportsStore *store.ReportsStore, messageIds []string) ([]DeadLetter, error) {
+	deadLetters, err := q.receiveAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var redriven, skipped []DeadLetter
+	for i, deadLetter := range deadLetters {
+		if len(messageIds) > 0 && !slices.Contains(messageIds, deadLetter.MessageId) {
+			skipped = append(skipped, deadLetter)
+			continue
+		}
+		if err := q.redrive(ctx, jobs, reportsStore, deadLetter); err != nil {
+			return redriven, errors.Join(err, q.release(ctx, append(skipped, deadLetters[i:]...)))
+		}
+		redriven = append(redriven, deadLetter)
+	}
+	return redriven, q.release(ctx, skipped)
+}
+
+func (q *DeadLetterQueue) redrive(ctx context.Context, jobs Queue, reportsStore *store.ReportsStore, deadLetter DeadLetter) error {
+	var job SqsMessage
+	if err := json.Unmarshal([]byte(deadLetter.Body), &job); err == nil && job.ReportId != uuid.Nil {
+		_, err := reportsStore.RequeueReport(ctx, job.UserId, job.ReportId, true, nil)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the report has been deleted, so there is nothing left to build
+			return q.ack(ctx, deadLetter)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to redrive %s: %w", deadLetter.MessageId, err)
+		}
+	}
+
+	if err := jobs.Send(ctx, []byte(deadLetter.Body)); err != nil {
+		return fmt.Errorf("failed to redrive %s: %w", deadLetter.MessageId, err)
+	}
+	return q.ack(ctx, deadLetter)
+}
+
+func (q *DeadLetterQueue) ack(ctx context.Context, deadLetter DeadLetter) error {
+	if err := q.queue.Ack(ctx, deadLetter.message); err != nil {
+		return fmt.Errorf("failed to delete dead letter %s: %w", deadLetter.MessageId, err)
+	}
+	return nil
+}
+
+func (q *DeadLetterQueue) receiveAll(ctx context.Context) ([]DeadLetter, error) {
+	var deadLetters []DeadLetter
+	seen := make(map[string]bool)
+	for {
+		messages, err := q.queue.Receive(ctx, 10, deadLetterReceiveWaitTime)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to receive dead letters: %w", err), q.release(ctx, deadLetters))
+		}
+
+		received := 0
+		for _, message := range messages {
+			if seen[message.Id] {
+				continue
+			}
+			seen[message.Id] = true
+			received++
+
+			deadLetter := DeadLetter{MessageId: message.Id, message: message}
+			if err := json.Unmarshal(message.Body, &deadLetter.DeadLetterMessage); err != nil {
+				deadLetter.Body = string(message.Body)
+			}
+			deadLetters = append(deadLetters, deadLetter)
+		}
+		if received == 0 {
+			return deadLetters, nil
+		}
+	}
+}
+
+func (q *DeadLetterQueue) release(ctx context.Context, deadLetters []DeadLetter) error {
+	var errs []error
+	for _, deadLetter := range deadLetters {
+		if err := q.queue.Nack(ctx, deadLetter.message, 0); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release dead letter %s: %w", deadLetter.MessageId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	jobs := NewMemoryQueue(time.Minute)
+	dlq := NewDeadLetterQueue(NewMemoryQueue(time.Minute))
+
+	require.NoError(t, dlq.Put(ctx, QueueMessage{Body: []byte("not json")}, 3, errors.New("compendium unavailable")))
+	require.NoError(t, dlq.Put(ctx, QueueMessage{Body: []byte("{}")}, 1, Permanent(ErrUnknownReportType)))
+
+	deadLetters, err := dlq.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+	require.Equal(t, "not json", deadLetters[0].Body)
+	require.Equal(t, "compendium unavailable", deadLetters[0].Error)
+	require.Equal(t, 3, deadLetters[0].Attempts)
+	require.WithinDuration(t, time.Now(), deadLetters[0].DeadLetteredAt, time.Minute)
+
+	// listing leaves the messages on the queue
+	deadLetters, err = dlq.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+
+	redriven, err := dlq.Redrive(ctx, jobs, nil, []string{deadLetters[0].MessageId})
+	require.NoError(t, err)
+	require.Len(t, redriven, 1)
+
+	messages, err := jobs.Receive(ctx, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "not json", string(messages[0].Body))
+
+	deadLetters, err = dlq.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, "{}", deadLetters[0].Body)
+}
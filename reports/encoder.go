@@ -0,0 +1,254 @@
+package reports
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	OutputFormatCSV    = "csv"
+	OutputFormatJSON   = "json"
+	OutputFormatNDJSON = "ndjson"
+	OutputFormatXLSX   = "xlsx"
+
+	DefaultOutputFormat = OutputFormatCSV
+)
+
+type Encoder interface {
+	Encode(w io.Writer, dataset *Dataset) error
+	Extension() string
+	ContentType() string
+}
+
+type csvEncoder struct{}
+
+func (csvEncoder) Encode(w io.Writer, dataset *Dataset) error {
+	csvWriter := csv.NewWriter(w)
+
+	if err := csvWriter.Write(dataset.Columns); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+
+	for _, row := range dataset.Rows {
+		csvRow := make([]string, len(row))
+		for i, value := range row {
+			csvRow[i] = formatValue(value)
+		}
+
+		if err := csvWriter.Write(csvRow); err != nil {
+			return fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+func (csvEncoder) Extension() string {
+	return "csv"
+}
+
+func (csvEncoder) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(w io.Writer, dataset *Dataset) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i, row := range dataset.Rows {
+		object, err := marshalRow(dataset.Columns, row)
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n"
+		if i == 0 {
+			separator = "\n"
+		}
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		if _, err := w.Write(object); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func (jsonEncoder) Extension() string {
+	return "json"
+}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(w io.Writer, dataset *Dataset) error {
+	for _, row := range dataset.Rows {
+		object, err := marshalRow(dataset.Columns, row)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(append(object, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonEncoder) Extension() string {
+	return "ndjson"
+}
+
+func (ndjsonEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+type xlsxEncoder struct{}
+
+func (xlsxEncoder) Encode(w io.Writer, dataset *Dataset) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	streamWriter, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to create xlsx stream writer: %w", err)
+	}
+
+	header := make([]any, len(dataset.Columns))
+	for i, column := range dataset.Columns {
+		header[i] = column
+	}
+	if err := streamWriter.SetRow("A1", header); err != nil {
+		return fmt.Errorf("failed to write xlsx header: %w", err)
+	}
+
+	for i, row := range dataset.Rows {
+		cells := make([]any, len(row))
+		for j, value := range row {
+			if values, ok := value.([]string); ok {
+				value = strings.Join(values, ", ")
+			}
+			cells[j] = value
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := streamWriter.SetRow(cell, cells); err != nil {
+			return fmt.Errorf("failed to write xlsx row: %w", err)
+		}
+	}
+
+	if err := streamWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush xlsx stream writer: %w", err)
+	}
+
+	if _, err := file.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+	return nil
+}
+
+func (xlsxEncoder) Extension() string {
+	return "xlsx"
+}
+
+func (xlsxEncoder) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// gzipEncoder compresses the output of the wrapped encoder. The result is a
+// gzip file rather than a gzip encoded one, so clients download it as is
+// instead of decompressing it under a .gz name.
+type gzipEncoder struct {
+	Encoder
+}
+
+func (e gzipEncoder) Encode(w io.Writer, dataset *Dataset) error {
+	gzipWriter := gzip.NewWriter(w)
+	if err := e.Encoder.Encode(gzipWriter, dataset); err != nil {
+		return err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return nil
+}
+
+func (e gzipEncoder) Extension() string {
+	return e.Encoder.Extension() + ".gz"
+}
+
+func (e gzipEncoder) ContentType() string {
+	return "application/gzip"
+}
+
+// marshalRow encodes a row as a JSON object whose keys keep the column order.
+func marshalRow(columns []string, row []any) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal column %s: %w", column, err)
+		}
+
+		value, err := json.Marshal(row[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal value of column %s: %w", column, err)
+		}
+
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,106 @@
+package reports
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func testDataset() *Dataset {
+	return &Dataset{
+		Columns: []string{"name", "id", "common_locations", "hearts_recovered", "dlc"},
+		Rows: [][]any{
+			{"Bokoblin", 1, []string{"Hyrule Field", "Gerudo Desert"}, 0.5, false},
+			{"Moblin", 2, []string(nil), 0.0, true},
+		},
+	}
+}
+
+func TestCsvEncoder(t *testing.T) {
+	encoder := gzipEncoder{csvEncoder{}}
+	require.Equal(t, "csv.gz", encoder.Extension())
+	require.Equal(t, "application/gzip", encoder.ContentType())
+
+	var buffer bytes.Buffer
+	require.NoError(t, encoder.Encode(&buffer, testDataset()))
+
+	gzipReader, err := gzip.NewReader(&buffer)
+	require.NoError(t, err)
+	records, err := csv.NewReader(gzipReader).ReadAll()
+	require.NoError(t, err)
+
+	require.Equal(t, [][]string{
+		{"name", "id", "common_locations", "hearts_recovered", "dlc"},
+		{"Bokoblin", "1", "Hyrule Field, Gerudo Desert", "0.5", "false"},
+		{"Moblin", "2", "", "0", "true"},
+	}, records)
+}
+
+func TestJsonEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	require.NoError(t, jsonEncoder{}.Encode(&buffer, testDataset()))
+
+	var rows []map[string]any
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &rows))
+	require.Len(t, rows, 2)
+	require.Equal(t, "Bokoblin", rows[0]["name"])
+	require.Equal(t, []any{"Hyrule Field", "Gerudo Desert"}, rows[0]["common_locations"])
+	require.Equal(t, true, rows[1]["dlc"])
+	require.True(t, strings.HasPrefix(buffer.String(), `[`+"\n"+`{"name":"Bokoblin","id":1,`))
+}
+
+func TestNdjsonEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	require.NoError(t, ndjsonEncoder{}.Encode(&buffer, testDataset()))
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var row map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &row))
+	}
+}
+
+func TestXlsxEncoder(t *testing.T) {
+	var buffer bytes.Buffer
+	require.NoError(t, xlsxEncoder{}.Encode(&buffer, testDataset()))
+
+	file, err := excelize.OpenReader(&buffer)
+	require.NoError(t, err)
+	defer file.Close()
+
+	rows, err := file.GetRows(file.GetSheetName(0))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, []string{"name", "id", "common_locations", "hearts_recovered", "dlc"}, rows[0])
+	require.Equal(t, "Hyrule Field, Gerudo Desert", rows[1][2])
+}
+
+func TestOutputFileKey(t *testing.T) {
+	registry := NewDefaultRegistry()
+	userId := uuid.MustParse("8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77")
+	reportId := uuid.MustParse("0f8d2b1c-5a77-4b8f-9b2e-8c3a4a3e6f31")
+
+	for _, tc := range []struct {
+		outputFormat string
+		key          string
+		contentType  string
+	}{
+		{OutputFormatCSV, "/users/8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77/report/0f8d2b1c-5a77-4b8f-9b2e-8c3a4a3e6f31.csv.gz", "application/gzip"},
+		{OutputFormatJSON, "/users/8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77/report/0f8d2b1c-5a77-4b8f-9b2e-8c3a4a3e6f31.json.gz", "application/gzip"},
+		{OutputFormatNDJSON, "/users/8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77/report/0f8d2b1c-5a77-4b8f-9b2e-8c3a4a3e6f31.ndjson.gz", "application/gzip"},
+		{OutputFormatXLSX, "/users/8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77/report/0f8d2b1c-5a77-4b8f-9b2e-8c3a4a3e6f31.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	} {
+		encoder, err := registry.LookupEncoder(tc.outputFormat)
+		require.NoError(t, err, tc.outputFormat)
+		require.Equal(t, tc.key, outputFileKey(userId, reportId, encoder), tc.outputFormat)
+		require.Equal(t, tc.contentType, encoder.ContentType(), tc.outputFormat)
+	}
+}
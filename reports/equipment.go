@@ -0,0 +1,37 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+)
+
+const ReportTypeEquipment = "equipment"
+
+type equipmentGenerator struct{}
+
+func (equipmentGenerator) Columns() []string {
+	return []string{"name", "id", "category", "description", "image", "common_locations", "attack", "defense", "effect", "type", "dlc"}
+}
+
+func (equipmentGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	resp, err := lozClient.GetEquipment(ctx, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get equipment from api: %w", err)
+	}
+
+	return buildRows(CategoryEquipment, resp.Data, func(equipment Equipment) []any {
+		return []any{
+			equipment.Name,
+			equipment.Id,
+			equipment.Category,
+			equipment.Description,
+			equipment.Image,
+			equipment.CommonLocations,
+			equipment.Properties.Attack,
+			equipment.Properties.Defense,
+			equipment.Properties.Effect,
+			equipment.Properties.Type,
+			equipment.Dlc,
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GamesColumn lists the games an entry appears in, it is only present in GameBoth reports.
+const GamesColumn = "games"
+
+func ColumnsFor(generator Generator, game string) []string {
+	columns := generator.Columns()
+	if game == GameBoth {
+		columns = append(slices.Clone(columns), GamesColumn)
+	}
+	return columns
+}
+
+// generate runs the generator for a single game, or for both games with the
+// rows merged by name when game is GameBoth.
+func generate(ctx context.Context, generator Generator, lozClient *LozClient, game string) ([][]any, error) {
+	if game != GameBoth {
+		return generator.Generate(ctx, lozClient, game)
+	}
+
+	nameIndex := slices.Index(generator.Columns(), "name")
+	if nameIndex < 0 {
+		return nil, fmt.Errorf("report type does not support game %s", GameBoth)
+	}
+
+	var rows [][]any
+	indexByName := make(map[string]int)
+	for _, g := range []string{GameTotk, GameBotw} {
+		gameRows, err := generator.Generate(ctx, lozClient, g)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range gameRows {
+			name := strings.ToLower(formatValue(row[nameIndex]))
+			if i, ok := indexByName[name]; ok {
+				games := rows[i][len(row)].([]string)
+				rows[i][len(row)] = append([]string{g}, games...)
+				continue
+			}
+
+			indexByName[name] = len(rows)
+			rows = append(rows, append(slices.Clone(row), []string{g}))
+		}
+	}
+	return rows, nil
+}
+
+func validateGame(game string) error {
+	switch game {
+	case "", GameBotw, GameTotk, GameBoth:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown game %q, valid games are: %s",
+		ErrInvalidParameters, game, strings.Join([]string{GameBotw, GameTotk, GameBoth}, ", "))
+}
@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+)
+
+type fakeHttpClient struct {
+	responses map[string]string
+}
+
+func (c *fakeHttpClient) Do(req *http.Request) (*http.Response, error) {
+	body, ok := c.responses[req.URL.Query().Get("game")]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestGenerateBothGames(t *testing.T) {
+	lozClient := NewLozClient(&config.Config{LozBaseUrl: "http://compendium.test"}, &fakeHttpClient{
+		responses: map[string]string{
+			GameBotw: `{"data": [{"name": "bokoblin", "id": 1}, {"name": "guardian stalker", "id": 2}]}`,
+			GameTotk: `{"data": [{"name": "bokoblin", "id": 10}, {"name": "gibdo", "id": 11}]}`,
+		},
+	}, nil, slog.Default())
+
+	generator := monstersGenerator{}
+	columns := ColumnsFor(generator, GameBoth)
+	require.Equal(t, GamesColumn, columns[len(columns)-1])
+
+	rows, err := generate(context.Background(), generator, lozClient, GameBoth)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	games := make(map[string][]string)
+	for _, row := range rows {
+		require.Len(t, row, len(columns))
+		games[row[0].(string)] = row[len(row)-1].([]string)
+	}
+	require.Equal(t, []string{GameBotw, GameTotk}, games["bokoblin"])
+	require.Equal(t, []string{GameTotk}, games["gibdo"])
+	require.Equal(t, []string{GameBotw}, games["guardian stalker"])
+}
+
+func TestGenerateSingleGame(t *testing.T) {
+	lozClient := NewLozClient(&config.Config{LozBaseUrl: "http://compendium.test"}, &fakeHttpClient{
+		responses: map[string]string{
+			GameBotw: `{"data": [{"name": "bokoblin", "id": 1}]}`,
+		},
+	}, nil, slog.Default())
+
+	generator := monstersGenerator{}
+	require.Equal(t, generator.Columns(), ColumnsFor(generator, GameBotw))
+
+	rows, err := generate(context.Background(), generator, lozClient, GameBotw)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Len(t, rows[0], len(generator.Columns()))
+}
@@ -1,27 +1,72 @@
 package reports
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"report-generation/config"
+)
+
+const (
+	CategoryMonsters  = "monsters"
+	CategoryCreatures = "creatures"
+	CategoryEquipment = "equipment"
+	CategoryMaterials = "materials"
+	CategoryTreasure  = "treasure"
 )
 
-const baseUrl = "https://botw-compendium.herokuapp.com/api/v3/compendium"
+const (
+	GameBotw = "botw"
+	GameTotk = "totk"
+	// GameBoth is only meaningful for reports, the API is always queried per game.
+	GameBoth = "both"
+
+	DefaultGame = GameTotk
+)
 
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
 type LozClient struct {
-	httpClient HttpClient
+	baseUrl      string
+	httpClient   HttpClient
+	cache        ResponseCache
+	cacheTTL     time.Duration
+	fetchTimeout time.Duration
+	group        singleflight.Group
+	logger       *slog.Logger
 }
 
-func NewLozClient(httpClient HttpClient) *LozClient {
+// NewLozClient creates a compendium client, cache may be nil to always call upstream.
+func NewLozClient(cfg *config.Config, httpClient HttpClient, cache ResponseCache, logger *slog.Logger) *LozClient {
 	return &LozClient{
-		httpClient: httpClient,
+		baseUrl:      strings.TrimSuffix(cfg.LozBaseUrl, "/"),
+		httpClient:   httpClient,
+		cache:        cache,
+		cacheTTL:     cfg.LozCacheTTL,
+		fetchTimeout: cfg.LozFetchTimeout,
+		logger:       logger,
 	}
 }
 
+type UpstreamStatusError struct {
+	StatusCode int
+	Url        string
+}
+
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.Url)
+}
+
 type Monster struct {
 	Name            string   `json:"name"`
 	Id              int      `json:"id"`
@@ -33,30 +78,217 @@ type Monster struct {
 	Dlc             bool     `json:"dlc"`
 }
 
-type GetMonstersResponse struct {
-	Data []Monster `json:"data"`
+type Creature struct {
+	Name            string   `json:"name"`
+	Id              int      `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	Edible          bool     `json:"edible"`
+	CookingEffect   string   `json:"cooking_effect"`
+	HeartsRecovered float64  `json:"hearts_recovered"`
+	Drops           []string `json:"drops"`
+	Dlc             bool     `json:"dlc"`
+}
+
+type EquipmentProperties struct {
+	Attack  int    `json:"attack"`
+	Defense int    `json:"defense"`
+	Effect  string `json:"effect"`
+	Type    string `json:"type"`
+}
+
+type Equipment struct {
+	Name            string              `json:"name"`
+	Id              int                 `json:"id"`
+	Category        string              `json:"category"`
+	Description     string              `json:"description"`
+	Image           string              `json:"image"`
+	CommonLocations []string            `json:"common_locations"`
+	Properties      EquipmentProperties `json:"properties"`
+	Dlc             bool                `json:"dlc"`
+}
+
+type Material struct {
+	Name            string   `json:"name"`
+	Id              int      `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	CookingEffect   string   `json:"cooking_effect"`
+	HeartsRecovered float64  `json:"hearts_recovered"`
+	FuseAttack      int      `json:"fuse_attack"`
+	Dlc             bool     `json:"dlc"`
+}
+
+type Treasure struct {
+	Name            string   `json:"name"`
+	Id              int      `json:"id"`
+	Category        string   `json:"category"`
+	Description     string   `json:"description"`
+	Image           string   `json:"image"`
+	CommonLocations []string `json:"common_locations"`
+	Drops           []string `json:"drops"`
+	Dlc             bool     `json:"dlc"`
+}
+
+type CategoryResponse[T any] struct {
+	Data []T `json:"data"`
+}
+
+type GetMonstersResponse = CategoryResponse[Monster]
+
+type GetCreaturesResponse = CategoryResponse[Creature]
+
+type GetEquipmentResponse = CategoryResponse[Equipment]
+
+type GetMaterialsResponse = CategoryResponse[Material]
+
+type GetTreasureResponse = CategoryResponse[Treasure]
+
+func (c *LozClient) GetMonsters(ctx context.Context, game string) (*GetMonstersResponse, error) {
+	return getCategory[Monster](ctx, c, CategoryMonsters, game)
+}
+
+func (c *LozClient) GetCreatures(ctx context.Context, game string) (*GetCreaturesResponse, error) {
+	return getCategory[Creature](ctx, c, CategoryCreatures, game)
+}
+
+func (c *LozClient) GetEquipment(ctx context.Context, game string) (*GetEquipmentResponse, error) {
+	return getCategory[Equipment](ctx, c, CategoryEquipment, game)
+}
+
+func (c *LozClient) GetMaterials(ctx context.Context, game string) (*GetMaterialsResponse, error) {
+	return getCategory[Material](ctx, c, CategoryMaterials, game)
+}
+
+func (c *LozClient) GetTreasure(ctx context.Context, game string) (*GetTreasureResponse, error) {
+	return getCategory[Treasure](ctx, c, CategoryTreasure, game)
+}
+
+func getCategory[T any](ctx context.Context, c *LozClient, category, game string) (*CategoryResponse[T], error) {
+	body, err := c.fetch(ctx, category, game)
+	if err != nil {
+		return nil, err
+	}
+
+	var responseBody *CategoryResponse[T]
+	if err := json.Unmarshal(body, &responseBody); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", category, err)
+	}
+
+	return responseBody, nil
+}
+
+// fetch returns the raw body for a category, serving it from the cache while
+// fresh and collapsing concurrent requests for the same key into one upstream call.
+// The shared call is detached from the caller that started it, so cancelling
+// one caller only stops that caller waiting.
+func (c *LozClient) fetch(ctx context.Context, category, game string) ([]byte, error) {
+	if c.cache == nil {
+		entry, err := c.fetchUpstream(ctx, category, game, nil)
+		if err != nil {
+			return nil, err
+		}
+		return entry.Body, nil
+	}
+
+	key := category + ":" + game
+	results := c.group.DoChan(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		if c.fetchTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.fetchTimeout)
+			defer cancel()
+		}
+
+		cached, err := c.cache.Get(ctx, key)
+		if err != nil {
+			// the cache is only an optimisation, fall back to upstream
+			c.logger.Warn("failed to read response cache", "key", key, "error", err)
+			cached = nil
+		}
+
+		if cached != nil && time.Since(cached.FetchedAt) < c.cacheTTL {
+			return cached.Body, nil
+		}
+
+		entry, err := c.fetchUpstream(ctx, category, game, cached)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.cache.Set(ctx, key, entry); err != nil {
+			c.logger.Warn("failed to write response cache", "key", key, "error", err)
+		}
+		return entry.Body, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	}
 }
 
-func (c *LozClient) GetMonsters() (*GetMonstersResponse, error) {
-	req, err := http.NewRequest(http.MethodGet, baseUrl+"/category/monsters", nil)
+// fetchUpstream calls the compendium API. When cached is set the request is
+// conditional and a 304 response refreshes the cached entry.
+func (c *LozClient) fetchUpstream(ctx context.Context, category, game string, cached *CacheEntry) (*CacheEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+"/category/"+category, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	reqUrl := req.URL
 	queryParams := req.URL.Query()
-	queryParams.Set("game", "totk")
+	queryParams.Set("game", game)
 	reqUrl.RawQuery = queryParams.Encode()
 
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error getting monsters: %w", err)
+		return nil, fmt.Errorf("error getting %s for %s: %w", category, game, err)
 	}
+	defer resp.Body.Close()
 
-	var responseBody *GetMonstersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return nil, fmt.Errorf("error parsing monsters: %w", err)
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed := *cached
+		refreshed.FetchedAt = time.Now()
+		return &refreshed, nil
 	}
 
-	return responseBody, nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("error getting %s for %s: %w", category, game, &UpstreamStatusError{
+			StatusCode: resp.StatusCode,
+			Url:        reqUrl.String(),
+		})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", category, err)
+	}
+
+	return &CacheEntry{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}, nil
 }
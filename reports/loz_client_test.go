@@ -0,0 +1,154 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+)
+
+func TestLozClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/category/monsters", r.URL.Path)
+		require.Equal(t, GameBotw, r.URL.Query().Get("game"))
+		w.Write([]byte(`{"data": [{"name": "bokoblin", "id": 1, "drops": ["bokoblin horn"]}]}`))
+	}))
+	defer srv.Close()
+
+	lozClient := NewLozClient(&config.Config{LozBaseUrl: srv.URL + "/"}, srv.Client(), nil, slog.Default())
+	resp, err := lozClient.GetMonsters(context.Background(), GameBotw)
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 1)
+	require.Equal(t, "bokoblin", resp.Data[0].Name)
+	require.Equal(t, []string{"bokoblin horn"}, resp.Data[0].Drops)
+}
+
+func TestLozClientUpstreamStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "application error", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	lozClient := NewLozClient(&config.Config{LozBaseUrl: srv.URL}, srv.Client(), nil, slog.Default())
+	_, err := lozClient.GetTreasure(context.Background(), GameTotk)
+
+	var statusErr *UpstreamStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+}
+
+func TestLozClientContextCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	lozClient := NewLozClient(&config.Config{LozBaseUrl: srv.URL}, srv.Client(), nil, slog.Default())
+	_, err := lozClient.GetCreatures(ctx, GameTotk)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLozClientCancelledCallerDoesNotFailWaiters(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte(`{"data": [{"name": "bokoblin", "id": 1}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{LozBaseUrl: srv.URL, LozCacheTTL: time.Hour, LozFetchTimeout: time.Minute}
+	lozClient := NewLozClient(cfg, srv.Client(), NewMemoryResponseCache(), slog.Default())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := lozClient.GetMonsters(ctx, GameTotk)
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	waiter := make(chan error, 1)
+	go func() {
+		resp, err := lozClient.GetMonsters(context.Background(), GameTotk)
+		if err == nil && len(resp.Data) != 1 {
+			err = fmt.Errorf("unexpected response %+v", resp)
+		}
+		waiter <- err
+	}()
+
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+
+	close(release)
+	require.NoError(t, <-waiter)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestLozClientCache(t *testing.T) {
+	var calls, conditionalCalls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditionalCalls.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		<-release
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"data": [{"name": "bokoblin", "id": 1}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{LozBaseUrl: srv.URL, LozCacheTTL: time.Hour}
+	cache := NewMemoryResponseCache()
+	lozClient := NewLozClient(cfg, srv.Client(), cache, slog.Default())
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := lozClient.GetMonsters(context.Background(), GameTotk)
+			require.NoError(t, err)
+			require.Len(t, resp.Data, 1)
+		}()
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), calls.Load())
+
+	_, err := lozClient.GetMonsters(context.Background(), GameTotk)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls.Load())
+
+	entry, err := cache.Get(context.Background(), "monsters:totk")
+	require.NoError(t, err)
+	entry.FetchedAt = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, cache.Set(context.Background(), "monsters:totk", entry))
+
+	resp, err := lozClient.GetMonsters(context.Background(), GameTotk)
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 1)
+	require.Equal(t, int32(2), calls.Load())
+	require.Equal(t, int32(1), conditionalCalls.Load())
+
+	entry, err = cache.Get(context.Background(), "monsters:totk")
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), entry.FetchedAt, time.Minute)
+}
@@ -0,0 +1,152 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"report-generation/config"
+)
+
+const (
+	MailerBackendSmtp = "smtp"
+	MailerBackendLog  = "log"
+)
+
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+func NewMailer(cfg *config.Config, logger *slog.Logger) (Mailer, error) {
+	switch cfg.MailerBackend {
+	case MailerBackendSmtp:
+		return NewSmtpMailer(cfg), nil
+	case MailerBackendLog:
+		return NewLogMailer(logger), nil
+	}
+	return nil, fmt.Errorf("unknown mailer backend: %s", cfg.MailerBackend)
+}
+
+// LogMailer logs the recipient and subject of emails instead of sending them,
+// for development. The body is left out since it may link to a report.
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+func NewLogMailer(logger *slog.Logger) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, email Email) error {
+	m.logger.Info("email", "to", email.To, "subject", email.Subject)
+	return nil
+}
+
+// SmtpMailer sends plain text emails through cfg.SmtpHost, upgrading the
+// connection with STARTTLS when the server offers it and authenticating when
+// cfg.SmtpUsername is set.
+type SmtpMailer struct {
+	cfg *config.Config
+	now func() time.Time
+}
+
+func NewSmtpMailer(cfg *config.Config) *SmtpMailer {
+	return &SmtpMailer{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+func (m *SmtpMailer) Send(ctx context.Context, email Email) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.SmtpTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.cfg.SmtpHost, m.cfg.SmtpPort)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.SmtpHost)
+	if err != nil {
+		return fmt.Errorf("failed to greet smtp server %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.SmtpHost}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	if m.cfg.SmtpUsername != "" {
+		auth := smtp.PlainAuth("", m.cfg.SmtpUsername, m.cfg.SmtpPassword, m.cfg.SmtpHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	message, err := m.message(email)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Mail(m.cfg.MailFrom); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := client.Rcpt(email.To); err != nil {
+		return fmt.Errorf("failed to set recipient %s: %w", email.To, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+func (m *SmtpMailer) message(email Email) ([]byte, error) {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", m.cfg.MailFrom)
+	fmt.Fprintf(&message, "To: %s\r\n", email.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", m.now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	message.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&message)
+	if _, err := body.Write([]byte(strings.ReplaceAll(email.Body, "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("failed to encode message body: %w", err)
+	}
+	if err := body.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode message body: %w", err)
+	}
+	return message.Bytes(), nil
+}
@@ -0,0 +1,174 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+)
+
+type receivedEmail struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// startFakeSmtpServer accepts a single SMTP session on a local port and sends
+// what it received on the returned channel.
+func startFakeSmtpServer(t *testing.T) (string, <-chan receivedEmail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	received := make(chan receivedEmail, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var email receivedEmail
+		text.PrintfLine("220 localhost fake smtp")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(command) {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "MAIL":
+				email.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				email.to = append(email.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+				email.data, err = text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				text.PrintfLine("250 OK")
+				received <- email
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSmtpMailer(t *testing.T) {
+	addr, received := startFakeSmtpServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	mailer := NewSmtpMailer(&config.Config{
+		SmtpHost:    host,
+		SmtpPort:    port,
+		SmtpTimeout: 5 * time.Second,
+		MailFrom:    "reports@test.com",
+	})
+	err = mailer.Send(context.Background(), Email{
+		To:      "test@test.com",
+		Subject: "Your monsters report is ready ✓",
+		Body:    "Hello,\n\nDownload it here:\nhttps://s3.test/report.csv?X-Amz-Signature=abc",
+	})
+	require.NoError(t, err)
+
+	email := <-received
+	require.Equal(t, "reports@test.com", email.from)
+	require.Equal(t, []string{"test@test.com"}, email.to)
+
+	message, err := mail.ReadMessage(bytes.NewReader(email.data))
+	require.NoError(t, err)
+	require.Equal(t, "reports@test.com", message.Header.Get("From"))
+	require.Equal(t, "test@test.com", message.Header.Get("To"))
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Your monsters report is ready ✓", subject)
+
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	require.NoError(t, err)
+	// the fake server hands over the message with bare line endings
+	require.Equal(t, "Hello,\n\nDownload it here:\nhttps://s3.test/report.csv?X-Amz-Signature=abc\n", string(body))
+}
+
+func TestSmtpMailerConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	listener.Close()
+
+	mailer := NewSmtpMailer(&config.Config{SmtpHost: host, SmtpPort: port, SmtpTimeout: time.Second})
+	err = mailer.Send(context.Background(), Email{To: "test@test.com"})
+	require.ErrorContains(t, err, "failed to connect to smtp server")
+}
+
+func TestLogMailer(t *testing.T) {
+	var buffer bytes.Buffer
+	mailer := NewLogMailer(slog.New(slog.NewTextHandler(&buffer, nil)))
+	err := mailer.Send(context.Background(), Email{
+		To:      "test@test.com",
+		Subject: "Your monsters report is ready",
+		Body:    "Download it with GET https://api.test/reports/1/download",
+	})
+	require.NoError(t, err)
+	require.Contains(t, buffer.String(), "test@test.com")
+	require.Contains(t, buffer.String(), "Your monsters report is ready")
+	require.NotContains(t, buffer.String(), "api.test")
+}
+
+func TestNewReportEmail(t *testing.T) {
+	createdAt := time.Date(2024, time.May, 12, 10, 30, 0, 0, time.UTC)
+	reportId := uuid.New()
+	data := ReportEmailData{
+		ReportId:     reportId,
+		ReportType:   "monsters",
+		OutputFormat: "csv",
+		CreatedAt:    createdAt,
+		DownloadUrl:  "https://api.test/reports/" + reportId.String() + "/download",
+	}
+
+	email, err := NewReportEmail("test@test.com", "completed", data)
+	require.NoError(t, err)
+	require.Equal(t, "test@test.com", email.To)
+	require.Equal(t, "Your monsters report is ready", email.Subject)
+	require.Contains(t, email.Body, "requested on 12 May 2024 10:30 UTC is ready")
+	require.Contains(t, email.Body, "GET https://api.test/reports/"+reportId.String()+"/download")
+
+	data.ErrorMessage = "upstream unavailable"
+	email, err = NewReportEmail("test@test.com", "failed", data)
+	require.NoError(t, err)
+	require.Equal(t, "Your monsters report failed", email.Subject)
+	require.Contains(t, email.Body, "Error: upstream unavailable")
+	require.Contains(t, email.Body, "POST /reports/"+data.ReportId.String()+"/retry")
+	require.NotContains(t, email.Body, "/download")
+
+	_, err = NewReportEmail("test@test.com", "cancelled", data)
+	require.Error(t, err)
+}
@@ -0,0 +1,36 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+)
+
+const ReportTypeMaterials = "materials"
+
+type materialsGenerator struct{}
+
+func (materialsGenerator) Columns() []string {
+	return []string{"name", "id", "category", "description", "image", "common_locations", "cooking_effect", "hearts_recovered", "fuse_attack", "dlc"}
+}
+
+func (materialsGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	resp, err := lozClient.GetMaterials(ctx, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get materials from api: %w", err)
+	}
+
+	return buildRows(CategoryMaterials, resp.Data, func(material Material) []any {
+		return []any{
+			material.Name,
+			material.Id,
+			material.Category,
+			material.Description,
+			material.Image,
+			material.CommonLocations,
+			material.CookingEffect,
+			material.HeartsRecovered,
+			material.FuseAttack,
+			material.Dlc,
+		}
+	})
+}
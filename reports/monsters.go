@@ -0,0 +1,34 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+)
+
+const ReportTypeMonsters = "monsters"
+
+type monstersGenerator struct{}
+
+func (monstersGenerator) Columns() []string {
+	return []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"}
+}
+
+func (monstersGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	resp, err := lozClient.GetMonsters(ctx, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monsters from api: %w", err)
+	}
+
+	return buildRows(CategoryMonsters, resp.Data, func(monster Monster) []any {
+		return []any{
+			monster.Name,
+			monster.Id,
+			monster.Category,
+			monster.Description,
+			monster.Image,
+			monster.CommonLocations,
+			monster.Drops,
+			monster.Dlc,
+		}
+	})
+}
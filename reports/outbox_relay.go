@@ -0,0 +1,57 @@
+package reports
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+// OutboxRelay publishes messages written to the outbox table to the queue.
+type OutboxRelay struct {
+	cfg         *config.Config
+	outboxStore *store.OutboxStore
+	queue       Queue
+	logger      *slog.Logger
+}
+
+func NewOutboxRelay(cfg *config.Config, outboxStore *store.OutboxStore, queue Queue, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		cfg:         cfg,
+		outboxStore: outboxStore,
+		queue:       queue,
+		logger:      logger,
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) error {
+	publish := func(ctx context.Context, message *store.OutboxMessage) error {
+		return r.queue.Send(ctx, message.Payload)
+	}
+
+	r.logger.Info("starting outbox relay", "queue", r.cfg.AWSSQSQueue)
+	ticker := time.NewTicker(r.cfg.OutboxPollInterval)
+	defer ticker.Stop()
+	for {
+		sent, err := r.outboxStore.PublishPending(ctx, r.cfg.OutboxBatchSize, publish)
+		if err != nil {
+			r.logger.Error("failed to relay outbox messages", "error", err)
+		}
+		if sent > 0 {
+			r.logger.Info("relayed outbox messages", "count", sent)
+		}
+
+		// keep draining without waiting while full batches are coming through
+		if err == nil && sent == r.cfg.OutboxBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
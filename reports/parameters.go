@@ -0,0 +1,229 @@
+package reports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	OperatorEq       = "eq"
+	OperatorNe       = "ne"
+	OperatorContains = "contains"
+	OperatorGt       = "gt"
+	OperatorGte      = "gte"
+	OperatorLt       = "lt"
+	OperatorLte      = "lte"
+)
+
+var ErrInvalidParameters = errors.New("invalid report parameters")
+
+type Filter struct {
+	Column   string `json:"column"`
+	Operator string `json:"operator"`
+	Value    any    `json:"value"`
+}
+
+type SortField struct {
+	Column     string `json:"column"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+type Parameters struct {
+	Game    string      `json:"game,omitempty"`
+	Filters []Filter    `json:"filters,omitempty"`
+	Columns []string    `json:"columns,omitempty"`
+	Sort    []SortField `json:"sort,omitempty"`
+}
+
+func ParseParameters(raw json.RawMessage) (*Parameters, error) {
+	var params Parameters
+	if len(raw) == 0 {
+		return &params, nil
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParameters, err)
+	}
+	return &params, nil
+}
+
+// Validate checks the parameters against the columns produced by a report type.
+func (p *Parameters) Validate(columns []string) error {
+	if err := validateGame(p.Game); err != nil {
+		return err
+	}
+
+	for _, filter := range p.Filters {
+		if !slices.Contains(columns, filter.Column) {
+			return fmt.Errorf("%w: unknown filter column %q", ErrInvalidParameters, filter.Column)
+		}
+		switch filter.Operator {
+		case "", OperatorEq, OperatorNe, OperatorContains:
+		case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+			if _, ok := toFloat(filter.Value); !ok {
+				return fmt.Errorf("%w: filter on %q with operator %q requires a numeric value",
+					ErrInvalidParameters, filter.Column, filter.Operator)
+			}
+		default:
+			return fmt.Errorf("%w: unknown filter operator %q", ErrInvalidParameters, filter.Operator)
+		}
+	}
+
+	for _, column := range p.Columns {
+		if !slices.Contains(columns, column) {
+			return fmt.Errorf("%w: unknown column %q", ErrInvalidParameters, column)
+		}
+	}
+
+	for _, sortField := range p.Sort {
+		if !slices.Contains(columns, sortField.Column) {
+			return fmt.Errorf("%w: unknown sort column %q", ErrInvalidParameters, sortField.Column)
+		}
+	}
+	return nil
+}
+
+func (p *Parameters) GameOrDefault() string {
+	if p.Game == "" {
+		return DefaultGame
+	}
+	return p.Game
+}
+
+// Apply filters, sorts and projects the dataset, in that order.
+func (p *Parameters) Apply(dataset *Dataset) (*Dataset, error) {
+	if err := p.Validate(dataset.Columns); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, 0, len(dataset.Rows))
+	for _, row := range dataset.Rows {
+		if p.matches(dataset.Columns, row) {
+			rows = append(rows, row)
+		}
+	}
+
+	if len(p.Sort) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, sortField := range p.Sort {
+				index := slices.Index(dataset.Columns, sortField.Column)
+				result := compareValues(rows[i][index], rows[j][index])
+				if result == 0 {
+					continue
+				}
+				if sortField.Descending {
+					return result > 0
+				}
+				return result < 0
+			}
+			return false
+		})
+	}
+
+	if len(p.Columns) == 0 {
+		return &Dataset{Columns: dataset.Columns, Rows: rows}, nil
+	}
+
+	indexes := make([]int, len(p.Columns))
+	for i, column := range p.Columns {
+		indexes[i] = slices.Index(dataset.Columns, column)
+	}
+
+	projected := make([][]any, len(rows))
+	for i, row := range rows {
+		projected[i] = make([]any, len(indexes))
+		for j, index := range indexes {
+			projected[i][j] = row[index]
+		}
+	}
+	return &Dataset{Columns: p.Columns, Rows: projected}, nil
+}
+
+func (p *Parameters) matches(columns []string, row []any) bool {
+	for _, filter := range p.Filters {
+		value := row[slices.Index(columns, filter.Column)]
+		if !filter.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) matches(value any) bool {
+	switch f.Operator {
+	case OperatorNe:
+		return !equalValues(value, f.Value)
+	case OperatorContains:
+		needle := strings.ToLower(formatValue(f.Value))
+		if values, ok := value.([]string); ok {
+			return slices.ContainsFunc(values, func(v string) bool {
+				return strings.EqualFold(v, needle)
+			})
+		}
+		return strings.Contains(strings.ToLower(formatValue(value)), needle)
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		left, ok := toFloat(value)
+		if !ok {
+			return false
+		}
+		right, _ := toFloat(f.Value)
+		switch f.Operator {
+		case OperatorGt:
+			return left > right
+		case OperatorGte:
+			return left >= right
+		case OperatorLt:
+			return left < right
+		default:
+			return left <= right
+		}
+	default:
+		return equalValues(value, f.Value)
+	}
+}
+
+func equalValues(value, expected any) bool {
+	if left, ok := toFloat(value); ok {
+		if right, ok := toFloat(expected); ok {
+			return left == right
+		}
+	}
+	return strings.EqualFold(formatValue(value), formatValue(expected))
+}
+
+func compareValues(a, b any) int {
+	if left, ok := toFloat(a); ok {
+		if right, ok := toFloat(b); ok {
+			switch {
+			case left < right:
+				return -1
+			case left > right:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(formatValue(a)), strings.ToLower(formatValue(b)))
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
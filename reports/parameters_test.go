@@ -0,0 +1,55 @@
+package reports
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParametersApply(t *testing.T) {
+	dataset := &Dataset{
+		Columns: []string{"name", "id", "common_locations", "dlc"},
+		Rows: [][]any{
+			{"Moblin", 2, []string{"Hyrule Field"}, false},
+			{"Bokoblin", 1, []string{"Hyrule Field", "Gerudo Desert"}, false},
+			{"Lizalfos", 3, []string{"Hyrule Field"}, true},
+			{"Lynel", 4, []string{"Gerudo Highlands"}, false},
+		},
+	}
+
+	params, err := ParseParameters(json.RawMessage(`{
+		"filters": [
+			{"column": "dlc", "operator": "eq", "value": false},
+			{"column": "common_locations", "operator": "contains", "value": "hyrule field"}
+		],
+		"columns": ["name", "id"],
+		"sort": [{"column": "name"}]
+	}`))
+	require.NoError(t, err)
+
+	result, err := params.Apply(dataset)
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "id"}, result.Columns)
+	require.Equal(t, [][]any{{"Bokoblin", 1}, {"Moblin", 2}}, result.Rows)
+
+	params = &Parameters{
+		Filters: []Filter{{Column: "id", Operator: OperatorGt, Value: 1.0}},
+		Sort:    []SortField{{Column: "id", Descending: true}},
+	}
+	result, err = params.Apply(dataset)
+	require.NoError(t, err)
+	require.Len(t, result.Rows, 3)
+	require.Equal(t, "Lynel", result.Rows[0][0])
+	require.Equal(t, "Moblin", result.Rows[2][0])
+}
+
+func TestParametersValidate(t *testing.T) {
+	columns := []string{"name", "dlc"}
+
+	require.NoError(t, (&Parameters{}).Validate(columns))
+	require.ErrorIs(t, (&Parameters{Columns: []string{"unknown"}}).Validate(columns), ErrInvalidParameters)
+	require.ErrorIs(t, (&Parameters{Sort: []SortField{{Column: "unknown"}}}).Validate(columns), ErrInvalidParameters)
+	require.ErrorIs(t, (&Parameters{Filters: []Filter{{Column: "name", Operator: "like"}}}).Validate(columns), ErrInvalidParameters)
+	require.ErrorIs(t, (&Parameters{Filters: []Filter{{Column: "name", Operator: OperatorGt, Value: "a"}}}).Validate(columns), ErrInvalidParameters)
+}
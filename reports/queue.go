@@ -0,0 +1,412 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const (
+	QueueBackendSqs      = "sqs"
+	QueueBackendMemory   = "memory"
+	QueueBackendPostgres = "postgres"
+)
+
+var (
+	ErrMessageNotFound = errors.New("queue message not found")
+	// ErrQueueNotShared is returned by RequireSharedQueue for the memory backend.
+	ErrQueueNotShared = errors.New("the memory queue backend only works within one process, run cmd/standalone or set QUEUE_BACKEND to sqs or postgres")
+)
+
+type QueueMessage struct {
+	Id            string
+	Body          []byte
+	ReceiptHandle string
+	// ReceiveCount is how many times the message has been delivered, including this time.
+	ReceiveCount int
+}
+
+// Queue is the job queue between the API and the workers. A received message
+// stays invisible to other consumers until it is acked, its visibility runs out
+// or it is nacked.
+type Queue interface {
+	Send(ctx context.Context, body []byte) error
+	// Receive waits up to waitTime for at least one message.
+	Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]QueueMessage, error)
+	Ack(ctx context.Context, message QueueMessage) error
+	ExtendVisibility(ctx context.Context, message QueueMessage, timeout time.Duration) error
+	// Nack makes the message visible again after delay.
+	Nack(ctx context.Context, message QueueMessage, delay time.Duration) error
+	// Depth returns the approximate number of messages waiting to be received.
+	Depth(ctx context.Context) (int, error)
+}
+
+var (
+	memoryQueuesMu sync.Mutex
+	memoryQueues   = make(map[string]*MemoryQueue)
+)
+
+// RequireSharedQueue checks that the selected backend reaches other processes.
+// The server, worker and admin binaries each run on their own, so jobs sent to
+// a memory queue by one of them would never reach the others. Only the
+// standalone binary, which runs the server and the worker together, can use it.
+func RequireSharedQueue(cfg *config.Config) error {
+	if cfg.QueueBackend == QueueBackendMemory {
+		return ErrQueueNotShared
+	}
+	return nil
+}
+
+// NewQueue creates the queue backend selected by cfg.QueueBackend. Memory queues
+// are shared by name within the process, so they only connect a producer and a
+// consumer running in the same binary.
+func NewQueue(ctx context.Context, cfg *config.Config, queueName string, sqsClient *sqs.Client, queueStore *store.QueueStore) (Queue, error) {
+	switch cfg.QueueBackend {
+	case QueueBackendSqs:
+		return NewSqsQueue(ctx, sqsClient, queueName)
+	case QueueBackendMemory:
+		memoryQueuesMu.Lock()
+		defer memoryQueuesMu.Unlock()
+		queue, ok := memoryQueues[queueName]
+		if !ok {
+			queue = NewMemoryQueue(cfg.QueueVisibilityTimeout)
+			memoryQueues[queueName] = queue
+		}
+		return queue, nil
+	case QueueBackendPostgres:
+		return NewPostgresQueue(queueStore, queueName, cfg.QueueVisibilityTimeout), nil
+	}
+	return nil, fmt.Errorf("unknown queue backend: %s", cfg.QueueBackend)
+}
+
+type SqsQueue struct {
+	sqsClient *sqs.Client
+	queueUrl  *string
+}
+
+func NewSqsQueue(ctx context.Context, sqsClient *sqs.Client, queueName string) (*SqsQueue, error) {
+	queueUrlOutput, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get url for queue: %s: %w", queueName, err)
+	}
+	return &SqsQueue{
+		sqsClient: sqsClient,
+		queueUrl:  queueUrlOutput.QueueUrl,
+	}, nil
+}
+
+func (q *SqsQueue) Send(ctx context.Context, body []byte) error {
+	_, err := q.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		MessageBody: aws.String(string(body)),
+		QueueUrl:    q.queueUrl,
+	})
+	return err
+}
+
+func (q *SqsQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]QueueMessage, error) {
+	messageOutput, err := q.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            q.queueUrl,
+		MaxNumberOfMessages: int32(maxMessages),
+		WaitTimeSeconds:     int32(waitTime.Seconds()),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]QueueMessage, 0, len(messageOutput.Messages))
+	for _, message := range messageOutput.Messages {
+		receiveCount, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		messages = append(messages, QueueMessage{
+			Id:            aws.ToString(message.MessageId),
+			Body:          []byte(aws.ToString(message.Body)),
+			ReceiptHandle: aws.ToString(message.ReceiptHandle),
+			ReceiveCount:  receiveCount,
+		})
+	}
+	return messages, nil
+}
+
+func (q *SqsQueue) Ack(ctx context.Context, message QueueMessage) error {
+	_, err := q.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      q.queueUrl,
+		ReceiptHandle: aws.String(message.ReceiptHandle),
+	})
+	return err
+}
+
+func (q *SqsQueue) ExtendVisibility(ctx context.Context, message QueueMessage, timeout time.Duration) error {
+	_, err := q.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          q.queueUrl,
+		ReceiptHandle:     aws.String(message.ReceiptHandle),
+		VisibilityTimeout: int32(timeout.Seconds()),
+	})
+	return err
+}
+
+func (q *SqsQueue) Nack(ctx context.Context, message QueueMessage, delay time.Duration) error {
+	return q.ExtendVisibility(ctx, message, delay)
+}
+
+func (q *SqsQueue) Depth(ctx context.Context) (int, error) {
+	attributesOutput, err := q.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: q.queueUrl,
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(attributesOutput.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+}
+
+type memoryMessage struct {
+	QueueMessage
+	visibleAt time.Time
+}
+
+// MemoryQueue is an in-process queue for tests and single-process deployments.
+type MemoryQueue struct {
+	mu                sync.Mutex
+	visibilityTimeout time.Duration
+	messages          []*memoryMessage
+	// notify is closed and replaced whenever a message becomes available
+	notify chan struct{}
+}
+
+func NewMemoryQueue(visibilityTimeout time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		visibilityTimeout: visibilityTimeout,
+		notify:            make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) Send(ctx context.Context, body []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append(q.messages, &memoryMessage{
+		QueueMessage: QueueMessage{
+			Id:   uuid.NewString(),
+			Body: body,
+		},
+		visibleAt: time.Now(),
+	})
+	q.broadcast()
+	return nil
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]QueueMessage, error) {
+	deadline := time.NewTimer(waitTime)
+	defer deadline.Stop()
+	for {
+		messages, nextVisibleAt, notify := q.receive(maxMessages)
+		if len(messages) > 0 {
+			return messages, nil
+		}
+
+		var wakeUp <-chan time.Time
+		if !nextVisibleAt.IsZero() {
+			wakeUp = time.After(time.Until(nextVisibleAt))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, nil
+		case <-notify:
+		case <-wakeUp:
+		}
+	}
+}
+
+// receive claims visible messages and reports when the next hidden one becomes visible.
+func (q *MemoryQueue) receive(maxMessages int) ([]QueueMessage, time.Time, chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var messages []QueueMessage
+	var nextVisibleAt time.Time
+	for _, message := range q.messages {
+		if message.visibleAt.After(now) {
+			if nextVisibleAt.IsZero() || message.visibleAt.Before(nextVisibleAt) {
+				nextVisibleAt = message.visibleAt
+			}
+			continue
+		}
+		if len(messages) == maxMessages {
+			break
+		}
+
+		message.ReceiveCount++
+		message.ReceiptHandle = uuid.NewString()
+		message.visibleAt = now.Add(q.visibilityTimeout)
+		messages = append(messages, message.QueueMessage)
+	}
+	return messages, nextVisibleAt, q.notify
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, message QueueMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, m := range q.messages {
+		if m.ReceiptHandle != "" && m.ReceiptHandle == message.ReceiptHandle {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrMessageNotFound, message.Id)
+}
+
+func (q *MemoryQueue) ExtendVisibility(ctx context.Context, message QueueMessage, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, m := range q.messages {
+		if m.ReceiptHandle != "" && m.ReceiptHandle == message.ReceiptHandle {
+			m.visibleAt = time.Now().Add(timeout)
+			q.broadcast()
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrMessageNotFound, message.Id)
+}
+
+func (q *MemoryQueue) Nack(ctx context.Context, message QueueMessage, delay time.Duration) error {
+	return q.ExtendVisibility(ctx, message, delay)
+}
+
+func (q *MemoryQueue) Depth(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	depth := 0
+	for _, message := range q.messages {
+		if !message.visibleAt.After(now) {
+			depth++
+		}
+	}
+	return depth, nil
+}
+
+// Len returns the number of messages in the queue, visible or not.
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+func (q *MemoryQueue) broadcast() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// PostgresQueue stores messages in the queue_messages table and claims them
+// with SELECT ... FOR UPDATE SKIP LOCKED, so any number of workers can share it.
+type PostgresQueue struct {
+	queueStore        *store.QueueStore
+	queueName         string
+	visibilityTimeout time.Duration
+	pollInterval      time.Duration
+}
+
+func NewPostgresQueue(queueStore *store.QueueStore, queueName string, visibilityTimeout time.Duration) *PostgresQueue {
+	return &PostgresQueue{
+		queueStore:        queueStore,
+		queueName:         queueName,
+		visibilityTimeout: visibilityTimeout,
+		pollInterval:      500 * time.Millisecond,
+	}
+}
+
+func (q *PostgresQueue) Send(ctx context.Context, body []byte) error {
+	_, err := q.queueStore.Send(ctx, q.queueName, body)
+	return err
+}
+
+func (q *PostgresQueue) Receive(ctx context.Context, maxMessages int, waitTime time.Duration) ([]QueueMessage, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		storedMessages, err := q.queueStore.Receive(ctx, q.queueName, maxMessages, q.visibilityTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(storedMessages) > 0 {
+			messages := make([]QueueMessage, 0, len(storedMessages))
+			for _, message := range storedMessages {
+				messages = append(messages, QueueMessage{
+					Id:            strconv.FormatInt(message.Id, 10),
+					Body:          message.Body,
+					ReceiptHandle: fmt.Sprintf("%d:%s", message.Id, message.ReceiptHandle),
+					ReceiveCount:  message.ReceiveCount,
+				})
+			}
+			return messages, nil
+		}
+
+		if !time.Now().Add(q.pollInterval).Before(deadline) {
+			return nil, nil
+		}
+		if err := sleep(ctx, q.pollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (q *PostgresQueue) Ack(ctx context.Context, message QueueMessage) error {
+	id, receiptHandle, err := parsePostgresReceiptHandle(message.ReceiptHandle)
+	if err != nil {
+		return err
+	}
+	return q.queueStore.Delete(ctx, id, receiptHandle)
+}
+
+func (q *PostgresQueue) ExtendVisibility(ctx context.Context, message QueueMessage, timeout time.Duration) error {
+	id, receiptHandle, err := parsePostgresReceiptHandle(message.ReceiptHandle)
+	if err != nil {
+		return err
+	}
+	return q.queueStore.SetVisibility(ctx, id, receiptHandle, timeout)
+}
+
+func (q *PostgresQueue) Nack(ctx context.Context, message QueueMessage, delay time.Duration) error {
+	return q.ExtendVisibility(ctx, message, delay)
+}
+
+func (q *PostgresQueue) Depth(ctx context.Context) (int, error) {
+	return q.queueStore.Depth(ctx, q.queueName)
+}
+
+func parsePostgresReceiptHandle(receiptHandle string) (int64, uuid.UUID, error) {
+	idStr, handleStr, ok := strings.Cut(receiptHandle, ":")
+	if !ok {
+		return 0, uuid.Nil, fmt.Errorf("invalid receipt handle: %s", receiptHandle)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, uuid.Nil, fmt.Errorf("invalid receipt handle: %s: %w", receiptHandle, err)
+	}
+	handle, err := uuid.Parse(handleStr)
+	if err != nil {
+		return 0, uuid.Nil, fmt.Errorf("invalid receipt handle: %s: %w", receiptHandle, err)
+	}
+	return id, handle, nil
+}
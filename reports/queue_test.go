@@ -0,0 +1,89 @@
+package reports
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+)
+
+func TestRequireSharedQueue(t *testing.T) {
+	require.ErrorIs(t, RequireSharedQueue(&config.Config{QueueBackend: QueueBackendMemory}), ErrQueueNotShared)
+	require.NoError(t, RequireSharedQueue(&config.Config{QueueBackend: QueueBackendSqs}))
+	require.NoError(t, RequireSharedQueue(&config.Config{QueueBackend: QueueBackendPostgres}))
+}
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryQueue(50 * time.Millisecond)
+
+	messages, err := queue.Receive(ctx, 10, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+
+	require.NoError(t, queue.Send(ctx, []byte("first")))
+	require.NoError(t, queue.Send(ctx, []byte("second")))
+
+	depth, err := queue.Depth(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, depth)
+
+	messages, err = queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "first", string(messages[0].Body))
+	require.Equal(t, 1, messages[0].ReceiveCount)
+	first := messages[0]
+
+	messages, err = queue.Receive(ctx, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "second", string(messages[0].Body))
+	require.NoError(t, queue.Ack(ctx, messages[0]))
+
+	depth, err = queue.Depth(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, depth)
+
+	// the first message reappears once its visibility times out
+	messages, err = queue.Receive(ctx, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, first.Id, messages[0].Id)
+	require.Equal(t, 2, messages[0].ReceiveCount)
+
+	// the receipt handle of the first delivery is stale
+	require.ErrorIs(t, queue.Ack(ctx, first), ErrMessageNotFound)
+
+	require.NoError(t, queue.ExtendVisibility(ctx, messages[0], time.Hour))
+	empty, err := queue.Receive(ctx, 10, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	require.NoError(t, queue.Nack(ctx, messages[0], 0))
+	messages, err = queue.Receive(ctx, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, 3, messages[0].ReceiveCount)
+
+	require.NoError(t, queue.Ack(ctx, messages[0]))
+	require.Equal(t, 0, queue.Len())
+}
+
+func TestMemoryQueueReceiveWakesOnSend(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryQueue(time.Minute)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		queue.Send(ctx, []byte("late"))
+	}()
+
+	messages, err := queue.Receive(ctx, 10, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "late", string(messages[0].Body))
+}
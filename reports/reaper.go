@@ -0,0 +1,97 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const reaperBatchSize = 100
+
+// Reaper finds reports left processing by a worker that died mid-build. Those
+// with attempts left are re-enqueued through the outbox. The rest are failed,
+// which queues their webhook event and emails their user.
+type Reaper struct {
+	cfg          *config.Config
+	reportsStore *store.ReportsStore
+	notifier     *ReportNotifier
+	logger       *slog.Logger
+}
+
+func NewReaper(cfg *config.Config, reportsStore *store.ReportsStore, notifier *ReportNotifier, logger *slog.Logger) *Reaper {
+	return &Reaper{
+		cfg:          cfg,
+		reportsStore: reportsStore,
+		notifier:     notifier,
+		logger:       logger,
+	}
+}
+
+func (r *Reaper) Start(ctx context.Context) error {
+	r.logger.Info("starting reaper", "interval", r.cfg.ReaperInterval, "stuck_after", r.cfg.ReaperStuckAfter)
+	ticker := time.NewTicker(r.cfg.ReaperInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.Reap(ctx); err != nil {
+			r.logger.Error("failed to reap stuck reports", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reaper) Reap(ctx context.Context) error {
+	stuckReports, err := r.reportsStore.ListStuckReports(ctx, time.Now().Add(-r.cfg.ReaperStuckAfter), reaperBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range stuckReports {
+		if err := r.reap(ctx, &report); err != nil {
+			r.logger.Error("failed to reap report", "report_id", report.Id, "error", err)
+		}
+	}
+	return nil
+}
+
+func (r *Reaper) reap(ctx context.Context, report *store.Report) error {
+	logger := r.logger.With(
+		"report_id", report.Id,
+		"user_id", report.UserId,
+		"worker_id", report.WorkerId,
+		"started_at", report.StartedAt,
+		"attempts", report.Attempts,
+	)
+
+	if report.Attempts >= r.cfg.JobMaxAttempts {
+		errMsg := fmt.Sprintf("report was still processing after %s and has no attempts left", r.cfg.ReaperStuckAfter)
+		failed, ok, err := r.reportsStore.FailStuckReport(ctx, report, errMsg, NewWebhookEvent)
+		if err != nil {
+			return err
+		}
+		if ok {
+			logger.Warn("failed stuck report")
+			if err := r.notifier.Notify(ctx, failed); err != nil {
+				logger.Error("failed to notify user", "error", err)
+			}
+		}
+		return nil
+	}
+
+	_, ok, err := r.reportsStore.RequeueStuckReport(ctx, report, NewJobMessage)
+	if err != nil {
+		return err
+	}
+	if ok {
+		logger.Warn("requeued stuck report")
+	}
+	return nil
+}
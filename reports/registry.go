@@ -0,0 +1,121 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownReportType   = errors.New("unknown report type")
+	ErrUnknownOutputFormat = errors.New("unknown output format")
+)
+
+type Dataset struct {
+	Columns []string
+	Rows    [][]any
+}
+
+type Generator interface {
+	Columns() []string
+	Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error)
+}
+
+type Registry struct {
+	mu         sync.RWMutex
+	generators map[string]Generator
+	encoders   map[string]Encoder
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		generators: make(map[string]Generator),
+		encoders:   make(map[string]Encoder),
+	}
+}
+
+// NewDefaultRegistry returns a registry with every built-in report type and output format registered.
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register(ReportTypeMonsters, monstersGenerator{})
+	registry.Register(ReportTypeCreatures, creaturesGenerator{})
+	registry.Register(ReportTypeEquipment, equipmentGenerator{})
+	registry.Register(ReportTypeMaterials, materialsGenerator{})
+	registry.Register(ReportTypeTreasure, treasureGenerator{})
+	registry.RegisterEncoder(OutputFormatCSV, gzipEncoder{csvEncoder{}})
+	registry.RegisterEncoder(OutputFormatJSON, gzipEncoder{jsonEncoder{}})
+	registry.RegisterEncoder(OutputFormatNDJSON, gzipEncoder{ndjsonEncoder{}})
+	registry.RegisterEncoder(OutputFormatXLSX, xlsxEncoder{})
+	return registry
+}
+
+func (r *Registry) Register(reportType string, generator Generator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generators[reportType] = generator
+}
+
+func (r *Registry) Lookup(reportType string) (Generator, error) {
+	r.mu.RLock()
+	generator, ok := r.generators[reportType]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, valid report types are: %s",
+			ErrUnknownReportType, reportType, strings.Join(r.ReportTypes(), ", "))
+	}
+	return generator, nil
+}
+
+func (r *Registry) ReportTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reportTypes := make([]string, 0, len(r.generators))
+	for reportType := range r.generators {
+		reportTypes = append(reportTypes, reportType)
+	}
+	sort.Strings(reportTypes)
+	return reportTypes
+}
+
+func (r *Registry) RegisterEncoder(outputFormat string, encoder Encoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoders[outputFormat] = encoder
+}
+
+func (r *Registry) LookupEncoder(outputFormat string) (Encoder, error) {
+	r.mu.RLock()
+	encoder, ok := r.encoders[outputFormat]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, valid output formats are: %s",
+			ErrUnknownOutputFormat, outputFormat, strings.Join(r.OutputFormats(), ", "))
+	}
+	return encoder, nil
+}
+
+func (r *Registry) OutputFormats() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	outputFormats := make([]string, 0, len(r.encoders))
+	for outputFormat := range r.encoders {
+		outputFormats = append(outputFormats, outputFormat)
+	}
+	sort.Strings(outputFormats)
+	return outputFormats
+}
+
+func buildRows[T any](category string, items []T, row func(T) []any) ([][]any, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no %s found", category)
+	}
+
+	rows := make([][]any, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, row(item))
+	}
+	return rows, nil
+}
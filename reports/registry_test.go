@@ -0,0 +1,50 @@
+package reports
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubGenerator struct{}
+
+func (stubGenerator) Columns() []string {
+	return []string{"name"}
+}
+
+func (stubGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	return [][]any{{"stub"}}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("stub", stubGenerator{})
+	registry.Register("another", stubGenerator{})
+
+	require.Equal(t, []string{"another", "stub"}, registry.ReportTypes())
+
+	generator, err := registry.Lookup("stub")
+	require.NoError(t, err)
+	require.Equal(t, []string{"name"}, generator.Columns())
+
+	_, err = registry.Lookup("unknown")
+	require.ErrorIs(t, err, ErrUnknownReportType)
+	require.Contains(t, err.Error(), "another, stub")
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	registry := NewDefaultRegistry()
+
+	for _, reportType := range []string{
+		ReportTypeMonsters,
+		ReportTypeCreatures,
+		ReportTypeEquipment,
+		ReportTypeMaterials,
+		ReportTypeTreasure,
+	} {
+		generator, err := registry.Lookup(reportType)
+		require.NoError(t, err)
+		require.NotEmpty(t, generator.Columns())
+	}
+}
@@ -0,0 +1,119 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+//go:embed templates/report_email.tmpl
+var emailTemplatesFS embed.FS
+
+var reportEmailTemplates = template.Must(template.ParseFS(emailTemplatesFS, "templates/report_email.tmpl"))
+
+type ReportEmailData struct {
+	ReportId     uuid.UUID
+	ReportType   string
+	OutputFormat string
+	CreatedAt    time.Time
+	DownloadUrl  string
+	ErrorMessage string
+}
+
+// NewReportEmail renders the email for a report that completed or failed. The
+// status selects the completed_* or failed_* templates.
+func NewReportEmail(to, status string, data ReportEmailData) (Email, error) {
+	var subject, body bytes.Buffer
+	if err := reportEmailTemplates.ExecuteTemplate(&subject, status+"_subject", data); err != nil {
+		return Email{}, fmt.Errorf("failed to render %s email subject: %w", status, err)
+	}
+	if err := reportEmailTemplates.ExecuteTemplate(&body, status+"_body", data); err != nil {
+		return Email{}, fmt.Errorf("failed to render %s email body: %w", status, err)
+	}
+	return Email{
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
+
+// ReportNotifier emails users when their reports complete or fail, unless they
+// opted out of email notifications.
+type ReportNotifier struct {
+	cfg              *config.Config
+	mailer           Mailer
+	userStore        *store.UserStore
+	preferencesStore *store.UserPreferencesStore
+	logger           *slog.Logger
+}
+
+func NewReportNotifier(
+	cfg *config.Config,
+	mailer Mailer,
+	userStore *store.UserStore,
+	preferencesStore *store.UserPreferencesStore,
+	logger *slog.Logger,
+) *ReportNotifier {
+	return &ReportNotifier{
+		cfg:              cfg,
+		mailer:           mailer,
+		userStore:        userStore,
+		preferencesStore: preferencesStore,
+		logger:           logger,
+	}
+}
+
+func (n *ReportNotifier) Notify(ctx context.Context, report *store.Report) error {
+	status := report.Status()
+	if status != "completed" && status != "failed" {
+		return nil
+	}
+
+	preferences, err := n.preferencesStore.GetUserPreferences(ctx, report.UserId)
+	if err != nil {
+		return err
+	}
+	if !preferences.EmailNotifications {
+		return nil
+	}
+
+	user, err := n.userStore.FindUserById(ctx, report.UserId)
+	if err != nil {
+		return err
+	}
+
+	data := ReportEmailData{
+		ReportId:     report.Id,
+		ReportType:   report.ReportType,
+		OutputFormat: report.OutputFormat,
+		CreatedAt:    report.CreatedAt,
+	}
+	if report.ErrorMessage != nil {
+		data.ErrorMessage = *report.ErrorMessage
+	}
+	if status == "completed" && report.OutputFilePath != nil {
+		// the API serves the file in every download mode, S3 may not be reachable
+		data.DownloadUrl = fmt.Sprintf("%s/reports/%s/download", strings.TrimSuffix(n.cfg.ApiBaseUrl, "/"), report.Id)
+	}
+
+	email, err := NewReportEmail(user.Email, status, data)
+	if err != nil {
+		return err
+	}
+
+	if err := n.mailer.Send(ctx, email); err != nil {
+		return fmt.Errorf("failed to send %s email: %w", status, err)
+	}
+	n.logger.Info("sent report email", "report_id", report.Id, "user_id", report.UserId, "status", status)
+	return nil
+}
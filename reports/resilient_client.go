@@ -0,0 +1,214 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"report-generation/config"
+)
+
+var ErrCircuitOpen = errors.New("compendium api circuit breaker is open")
+
+// ResilientHttpClient wraps an HttpClient with retries, exponential backoff
+// with full jitter and a circuit breaker shared by every request.
+type ResilientHttpClient struct {
+	httpClient  HttpClient
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	breaker     *circuitBreaker
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+func NewResilientHttpClient(cfg *config.Config, httpClient HttpClient) *ResilientHttpClient {
+	return &ResilientHttpClient{
+		httpClient:  httpClient,
+		maxAttempts: max(cfg.LozMaxAttempts, 1),
+		baseDelay:   cfg.LozRetryBaseDelay,
+		maxDelay:    cfg.LozRetryMaxDelay,
+		breaker:     newCircuitBreaker(cfg.LozBreakerThreshold, cfg.LozBreakerCooldown),
+		sleep:       sleep,
+	}
+}
+
+func (c *ResilientHttpClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	var lastErr error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		if !c.breaker.Allow() {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w after %d attempts: %w", ErrCircuitOpen, attempt-1, lastErr)
+			}
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := c.httpClient.Do(req.Clone(ctx))
+		if ctx.Err() != nil {
+			// the caller gave up, this says nothing about upstream health
+			if err == nil {
+				resp.Body.Close()
+			}
+			c.breaker.Release()
+			return nil, ctx.Err()
+		}
+
+		var retryAfter time.Duration
+		switch {
+		case err != nil && isTimeout(err):
+			lastErr = err
+		case err != nil:
+			c.breaker.Failure()
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			lastErr = &UpstreamStatusError{StatusCode: resp.StatusCode, Url: req.URL.String()}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			c.breaker.Success()
+			return resp, nil
+		}
+
+		c.breaker.Failure()
+		if attempt == c.maxAttempts {
+			break
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > c.maxDelay {
+				return nil, fmt.Errorf("upstream asked to retry after %s, giving up after %d attempts: %w", retryAfter, attempt, lastErr)
+			}
+			delay = retryAfter
+		}
+
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("giving up after %d attempts: %w", c.maxAttempts, lastErr)
+}
+
+func (c *ResilientHttpClient) backoff(attempt int) time.Duration {
+	delay := c.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return rand.N(delay + 1)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// parseRetryAfter accepts both the delay-seconds and the HTTP-date form.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker opens after threshold consecutive failures and lets a single
+// probe request through once cooldown has passed.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// a probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// Release ends a request that finished without telling anything about
+// upstream health. An abandoned probe reopens the breaker for another cooldown,
+// otherwise it would stay half-open and refuse every request.
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
@@ -0,0 +1,159 @@
+package reports
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+)
+
+type scriptedHttpClient struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (c *scriptedHttpClient) Do(req *http.Request) (*http.Response, error) {
+	resp := c.responses[min(c.calls, len(c.responses)-1)]
+	c.calls++
+	return &http.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func newTestResilientHttpClient(httpClient HttpClient, delays *[]time.Duration) *ResilientHttpClient {
+	client := NewResilientHttpClient(&config.Config{
+		LozMaxAttempts:      3,
+		LozRetryBaseDelay:   100 * time.Millisecond,
+		LozRetryMaxDelay:    5 * time.Second,
+		LozBreakerThreshold: 5,
+		LozBreakerCooldown:  time.Minute,
+	}, httpClient)
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return client
+}
+
+func TestResilientHttpClientRetries(t *testing.T) {
+	httpClient := &scriptedHttpClient{
+		responses: []*http.Response{
+			{StatusCode: http.StatusBadGateway},
+			{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"2"}}},
+			{StatusCode: http.StatusOK},
+		},
+	}
+	var delays []time.Duration
+	client := newTestResilientHttpClient(httpClient, &delays)
+
+	req, err := http.NewRequest(http.MethodGet, "http://compendium.test", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, httpClient.calls)
+	require.Len(t, delays, 2)
+	require.LessOrEqual(t, delays[0], 100*time.Millisecond)
+	require.Equal(t, 2*time.Second, delays[1])
+}
+
+func TestResilientHttpClientGivesUp(t *testing.T) {
+	httpClient := &scriptedHttpClient{
+		responses: []*http.Response{{StatusCode: http.StatusServiceUnavailable}},
+	}
+	var delays []time.Duration
+	client := newTestResilientHttpClient(httpClient, &delays)
+
+	req, err := http.NewRequest(http.MethodGet, "http://compendium.test", nil)
+	require.NoError(t, err)
+
+	_, err = client.Do(req)
+	require.ErrorContains(t, err, "giving up after 3 attempts")
+
+	var statusErr *UpstreamStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+}
+
+func TestResilientHttpClientDoesNotRetryClientErrors(t *testing.T) {
+	httpClient := &scriptedHttpClient{
+		responses: []*http.Response{{StatusCode: http.StatusNotFound}},
+	}
+	var delays []time.Duration
+	client := newTestResilientHttpClient(httpClient, &delays)
+
+	req, err := http.NewRequest(http.MethodGet, "http://compendium.test", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, 1, httpClient.calls)
+	require.Empty(t, delays)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	require.True(t, breaker.Allow())
+	breaker.Failure()
+	require.True(t, breaker.Allow())
+	breaker.Failure()
+	require.False(t, breaker.Allow())
+
+	now = now.Add(time.Minute)
+	require.True(t, breaker.Allow())
+	require.False(t, breaker.Allow())
+
+	breaker.Failure()
+	require.False(t, breaker.Allow())
+
+	now = now.Add(time.Minute)
+	require.True(t, breaker.Allow())
+	breaker.Success()
+	require.True(t, breaker.Allow())
+	require.True(t, breaker.Allow())
+}
+
+type cancellingHttpClient struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancellingHttpClient) Do(req *http.Request) (*http.Response, error) {
+	c.cancel()
+	return nil, req.Context().Err()
+}
+
+func TestResilientHttpClientReleasesCancelledProbe(t *testing.T) {
+	now := time.Now()
+	var delays []time.Duration
+	client := newTestResilientHttpClient(&scriptedHttpClient{}, &delays)
+	client.breaker = newCircuitBreaker(1, time.Minute)
+	client.breaker.now = func() time.Time { return now }
+	client.breaker.Failure()
+
+	now = now.Add(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	client.httpClient = &cancellingHttpClient{cancel: cancel}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://compendium.test", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// the abandoned probe reopened the breaker instead of leaving it half-open
+	require.False(t, client.breaker.Allow())
+	now = now.Add(time.Minute)
+	require.True(t, client.breaker.Allow())
+}
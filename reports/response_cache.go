@@ -0,0 +1,111 @@
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const (
+	CacheBackendNone     = "none"
+	CacheBackendMemory   = "memory"
+	CacheBackendPostgres = "postgres"
+)
+
+type CacheEntry struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+}
+
+// ResponseCache stores raw compendium responses. Get returns nil without an
+// error when there is no entry for the key.
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	Set(ctx context.Context, key string, entry *CacheEntry) error
+}
+
+func NewResponseCache(cfg *config.Config, responseCacheStore *store.ResponseCacheStore) (ResponseCache, error) {
+	switch cfg.LozCacheBackend {
+	case CacheBackendNone:
+		return nil, nil
+	case CacheBackendMemory:
+		return NewMemoryResponseCache(), nil
+	case CacheBackendPostgres:
+		return NewPostgresResponseCache(responseCacheStore), nil
+	}
+	return nil, fmt.Errorf("unknown cache backend: %s", cfg.LozCacheBackend)
+}
+
+type MemoryResponseCache struct {
+	mu      sync.RWMutex
+	entries map[string]CacheEntry
+}
+
+func NewMemoryResponseCache() *MemoryResponseCache {
+	return &MemoryResponseCache{
+		entries: make(map[string]CacheEntry),
+	}
+}
+
+func (c *MemoryResponseCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (c *MemoryResponseCache) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = *entry
+	return nil
+}
+
+// PostgresResponseCache shares cached responses between every worker replica.
+type PostgresResponseCache struct {
+	responseCacheStore *store.ResponseCacheStore
+}
+
+func NewPostgresResponseCache(responseCacheStore *store.ResponseCacheStore) *PostgresResponseCache {
+	return &PostgresResponseCache{
+		responseCacheStore: responseCacheStore,
+	}
+}
+
+func (c *PostgresResponseCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	cachedResponse, err := c.responseCacheStore.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &CacheEntry{
+		Body:         cachedResponse.Body,
+		ETag:         cachedResponse.ETag,
+		LastModified: cachedResponse.LastModified,
+		FetchedAt:    cachedResponse.FetchedAt,
+	}, nil
+}
+
+func (c *PostgresResponseCache) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	_, err := c.responseCacheStore.Upsert(ctx, &store.CachedResponse{
+		Key:          key,
+		Body:         entry.Body,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		FetchedAt:    entry.FetchedAt,
+	})
+	return err
+}
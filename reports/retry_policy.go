@@ -0,0 +1,69 @@
+package reports
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"report-generation/config"
+)
+
+// PermanentError marks a job failure that will fail the same way on every
+// attempt, such as an unknown report type or invalid parameters.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewRetryPolicy(cfg *config.Config) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: cfg.JobMaxAttempts,
+		BaseDelay:   cfg.JobRetryBaseDelay,
+		MaxDelay:    cfg.JobRetryMaxDelay,
+	}
+}
+
+// ShouldRetry reports whether a job that failed with err after the given
+// number of attempts should go back on the queue rather than to the
+// dead-letter queue.
+func (p RetryPolicy) ShouldRetry(attempts int, err error) bool {
+	return !IsPermanent(err) && attempts < p.MaxAttempts
+}
+
+// Delay returns how long a job stays hidden before its next attempt. It grows
+// exponentially with the attempt number, half of it jittered, up to MaxDelay.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay << max(attempts-1, 0)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
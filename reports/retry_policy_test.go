@@ -0,0 +1,42 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+	transient := errors.New("compendium unavailable")
+
+	require.True(t, policy.ShouldRetry(1, transient))
+	require.True(t, policy.ShouldRetry(2, transient))
+	require.False(t, policy.ShouldRetry(3, transient))
+
+	permanent := fmt.Errorf("failed to build report: %w", Permanent(ErrUnknownReportType))
+	require.True(t, IsPermanent(permanent))
+	require.ErrorIs(t, permanent, ErrUnknownReportType)
+	require.False(t, policy.ShouldRetry(1, permanent))
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for range 100 {
+		delay := policy.Delay(1)
+		require.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		require.LessOrEqual(t, delay, time.Second)
+
+		delay = policy.Delay(2)
+		require.GreaterOrEqual(t, delay, time.Second)
+		require.LessOrEqual(t, delay, 2*time.Second)
+
+		delay = policy.Delay(8)
+		require.GreaterOrEqual(t, delay, 2500*time.Millisecond)
+		require.LessOrEqual(t, delay, 5*time.Second)
+	}
+}
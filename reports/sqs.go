@@ -1,8 +1,27 @@
 package reports
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"report-generation/db/store"
+)
 
 type SqsMessage struct {
 	UserId   uuid.UUID `json:"userId"`
 	ReportId uuid.UUID `json:"reportId"`
+	Game     string    `json:"game,omitempty"`
+}
+
+// NewJobMessage builds the queue message that asks a worker to build report.
+func NewJobMessage(report *store.Report) (json.RawMessage, error) {
+	message := SqsMessage{
+		UserId:   report.UserId,
+		ReportId: report.Id,
+	}
+	if params, err := ParseParameters(report.Parameters); err == nil {
+		message.Game = params.GameOrDefault()
+	}
+	return json.Marshal(message)
 }
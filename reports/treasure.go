@@ -0,0 +1,34 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+)
+
+const ReportTypeTreasure = "treasure"
+
+type treasureGenerator struct{}
+
+func (treasureGenerator) Columns() []string {
+	return []string{"name", "id", "category", "description", "image", "common_locations", "drops", "dlc"}
+}
+
+func (treasureGenerator) Generate(ctx context.Context, lozClient *LozClient, game string) ([][]any, error) {
+	resp, err := lozClient.GetTreasure(ctx, game)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get treasure from api: %w", err)
+	}
+
+	return buildRows(CategoryTreasure, resp.Data, func(treasure Treasure) []any {
+		return []any{
+			treasure.Name,
+			treasure.Id,
+			treasure.Category,
+			treasure.Description,
+			treasure.Image,
+			treasure.CommonLocations,
+			treasure.Drops,
+			treasure.Dlc,
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const (
+	WebhookEventReportCompleted = "report.completed"
+	WebhookEventReportFailed    = "report.failed"
+)
+
+var ErrWebhookAddressNotAllowed = errors.New("webhook address is not a public address")
+
+// nonPublicPrefixes are the ranges netip.Addr has no predicate for that must
+// not be reachable from webhooks either.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+type WebhookPayload struct {
+	Event        string     `json:"event"`
+	ReportId     uuid.UUID  `json:"reportId"`
+	ReportType   string     `json:"reportType"`
+	OutputFormat string     `json:"outputFormat"`
+	Status       string     `json:"status"`
+	ErrorMessage *string    `json:"errorMessage,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	FailedAt     *time.Time `json:"failedAt,omitempty"`
+}
+
+// NewWebhookEvent builds the webhook event for a report that has been
+// finalized. It returns an empty name for reports that did not finish, such
+// as cancelled ones.
+func NewWebhookEvent(report *store.Report) (string, json.RawMessage, error) {
+	var event string
+	switch report.Status() {
+	case "completed":
+		event = WebhookEventReportCompleted
+	case "failed":
+		event = WebhookEventReportFailed
+	default:
+		return "", nil, nil
+	}
+
+	payload, err := json.Marshal(WebhookPayload{
+		Event:        event,
+		ReportId:     report.Id,
+		ReportType:   report.ReportType,
+		OutputFormat: report.OutputFormat,
+		Status:       report.Status(),
+		ErrorMessage: report.ErrorMessage,
+		CreatedAt:    report.CreatedAt,
+		CompletedAt:  report.CompletedAt,
+		FailedAt:     report.FailedAt,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	return event, payload, nil
+}
+
+// SignWebhookPayload returns the signature sent in WebhookSignatureHeader: the
+// hex encoded HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// webhook secret. Receivers recompute it to check the payload came from us and
+// reject old timestamps to stop replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookHttpClient returns the client webhooks are sent with. Any user can
+// register a webhook, so unless cfg.WebhookAllowPrivate is set it refuses to
+// connect to loopback, private, link-local and other non-public addresses,
+// which would reach the worker admin, LocalStack or cloud metadata. The check
+// runs on the resolved address of every connection, and redirects are not
+// followed, so neither DNS nor a redirect can get around it.
+func NewWebhookHttpClient(cfg *config.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.WebhookTimeout,
+	}
+	if !cfg.WebhookAllowPrivate {
+		dialer.Control = rejectNonPublicAddress
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.WebhookTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func rejectNonPublicAddress(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, address)
+	}
+	if !isPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, addrPort.Addr())
+	}
+	return nil
+}
+
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookDispatcher sends queued webhook deliveries, retrying failed ones with
+// exponential backoff until cfg.WebhookMaxAttempts attempts have been made.
+type WebhookDispatcher struct {
+	cfg          *config.Config
+	webhookStore *store.WebhookStore
+	httpClient   HttpClient
+	retryPolicy  RetryPolicy
+	logger       *slog.Logger
+	now          func() time.Time
+}
+
+func NewWebhookDispatcher(cfg *config.Config, webhookStore *store.WebhookStore, httpClient HttpClient, logger *slog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cfg:          cfg,
+		webhookStore: webhookStore,
+		httpClient:   httpClient,
+		retryPolicy: RetryPolicy{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			BaseDelay:   cfg.WebhookRetryBaseDelay,
+			MaxDelay:    cfg.WebhookRetryMaxDelay,
+		},
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context) error {
+	d.logger.Info("starting webhook dispatcher", "interval", d.cfg.WebhookPollInterval)
+	ticker := time.NewTicker(d.cfg.WebhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			d.logger.Error("failed to dispatch webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch sends the deliveries that are due concurrently. They are leased for
+// twice the request timeout, long enough to send and record every one of them.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) error {
+	deliveries, err := d.webhookStore.ClaimDueDeliveries(ctx, d.cfg.WebhookBatchSize, 2*d.cfg.WebhookTimeout)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, &delivery)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *store.PendingWebhookDelivery) {
+	logger := d.logger.With(
+		"delivery_id", delivery.Id,
+		"webhook_id", delivery.WebhookId,
+		"report_id", delivery.ReportId,
+		"event", delivery.Event,
+	)
+
+	statusCode, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.webhookStore.CompleteDelivery(ctx, delivery.Id, statusCode); err != nil {
+			logger.Error("failed to record webhook delivery", "error", err)
+		}
+		return
+	}
+
+	var responseStatus *int
+	if statusCode != 0 {
+		responseStatus = &statusCode
+	}
+
+	attempts := delivery.Attempts + 1
+	var nextAttemptAt *time.Time
+	if attempts < d.retryPolicy.MaxAttempts {
+		next := d.now().Add(d.retryPolicy.Delay(attempts))
+		nextAttemptAt = &next
+		logger.Warn("webhook delivery failed, retrying", "attempts", attempts, "next_attempt_at", next, "error", err)
+	} else {
+		logger.Error("webhook delivery failed, giving up", "attempts", attempts, "error", err)
+	}
+
+	if err := d.webhookStore.FailDeliveryAttempt(ctx, delivery.Id, responseStatus, err.Error(), nextAttemptAt); err != nil {
+		logger.Error("failed to record webhook delivery attempt", "error", err)
+	}
+}
+
+// send posts the payload and returns the response status, which is zero when
+// no response was received. Any status outside 2xx is an error.
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *store.PendingWebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.Id.String())
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,130 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+func TestNewWebhookEvent(t *testing.T) {
+	now := time.Now()
+	errMsg := "upstream unavailable"
+	report := &store.Report{
+		Id:           uuid.New(),
+		ReportType:   "monsters",
+		OutputFormat: "csv",
+		CreatedAt:    now,
+		StartedAt:    &now,
+	}
+
+	event, _, err := NewWebhookEvent(report)
+	require.NoError(t, err)
+	require.Empty(t, event)
+
+	report.FailedAt = &now
+	report.ErrorMessage = &errMsg
+	event, payload, err := NewWebhookEvent(report)
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventReportFailed, event)
+
+	var webhookPayload WebhookPayload
+	require.NoError(t, json.Unmarshal(payload, &webhookPayload))
+	require.Equal(t, WebhookEventReportFailed, webhookPayload.Event)
+	require.Equal(t, report.Id, webhookPayload.ReportId)
+	require.Equal(t, "failed", webhookPayload.Status)
+	require.Equal(t, &errMsg, webhookPayload.ErrorMessage)
+
+	report.CancelledAt = &now
+	event, _, err = NewWebhookEvent(report)
+	require.NoError(t, err)
+	require.Empty(t, event)
+}
+
+func TestWebhookDispatcherSend(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	delivery := &store.PendingWebhookDelivery{
+		WebhookDelivery: store.WebhookDelivery{
+			Id:      uuid.New(),
+			Event:   WebhookEventReportCompleted,
+			Payload: json.RawMessage(`{"event": "report.completed"}`),
+		},
+		Secret: "secret",
+	}
+
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, []byte(delivery.Payload), body)
+		require.Equal(t, WebhookEventReportCompleted, r.Header.Get(WebhookEventHeader))
+		require.Equal(t, delivery.Id.String(), r.Header.Get(WebhookDeliveryHeader))
+		require.Equal(t, strconv.FormatInt(now.Unix(), 10), r.Header.Get(WebhookTimestampHeader))
+		require.Equal(t, SignWebhookPayload("secret", now.Unix(), body), r.Header.Get(WebhookSignatureHeader))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	delivery.Url = srv.URL
+
+	dispatcher := NewWebhookDispatcher(&config.Config{WebhookTimeout: time.Second}, nil, srv.Client(), slog.Default())
+	dispatcher.now = func() time.Time { return now }
+
+	statusCode, err := dispatcher.send(context.Background(), delivery)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, statusCode)
+
+	status = http.StatusInternalServerError
+	statusCode, err = dispatcher.send(context.Background(), delivery)
+	require.ErrorContains(t, err, "responded with status 500")
+	require.Equal(t, http.StatusInternalServerError, statusCode)
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	signature := SignWebhookPayload("secret", 1700000000, []byte(`{}`))
+	require.Equal(t, signature, SignWebhookPayload("secret", 1700000000, []byte(`{}`)))
+	require.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+	require.NotEqual(t, signature, SignWebhookPayload("other", 1700000000, []byte(`{}`)))
+	require.NotEqual(t, signature, SignWebhookPayload("secret", 1700000001, []byte(`{}`)))
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		require.True(t, isPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1",
+	} {
+		require.False(t, isPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestWebhookHttpClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	client := NewWebhookHttpClient(&config.Config{WebhookTimeout: time.Second})
+	_, err := client.Post(srv.URL, "application/json", nil)
+	require.ErrorIs(t, err, ErrWebhookAddressNotAllowed)
+
+	// redirects are handed back instead of followed
+	client = NewWebhookHttpClient(&config.Config{WebhookTimeout: time.Second, WebhookAllowPrivate: true})
+	resp, err := client.Post(srv.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+}
@@ -5,104 +5,294 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const (
+	// SQS rejects receives for more than 10 messages or long polls over 20s.
+	maxReceiveBatchSize = 10
+	maxReceiveWaitTime  = 20 * time.Second
+
+	receiveErrorDelay = time.Second
+	// how often a worker with every slot taken checks for a free one
+	capacityPollInterval = 100 * time.Millisecond
 )
 
+// failureRecorder records a failed build on its report once the worker has
+// decided whether the job is retried. ReportBuilder implements it.
+type failureRecorder interface {
+	Requeue(ctx context.Context, report *store.Report, cause error) error
+	Fail(ctx context.Context, report *store.Report, cause error) error
+}
+
 type Worker struct {
-	cfg           *config.Config
-	reportBuilder *ReportBuilder
-	logger        *slog.Logger
-	sqsClient     *sqs.Client
-	sqsMsgChannel chan types.Message
-	concurrency   int
+	cfg             *config.Config
+	reportBuilder   *ReportBuilder
+	failures        failureRecorder
+	reportsStore    *store.ReportsStore
+	logger          *slog.Logger
+	queue           Queue
+	deadLetterQueue *DeadLetterQueue
+	retryPolicy     RetryPolicy
+	msgChannel      chan QueueMessage
+	concurrency     int
+	// busy is the number of goroutines currently processing a message
+	busy             atomic.Int32
+	receiveBatchSize int
+	receiveWaitTime  time.Duration
 }
 
-func NewWorker(cfg *config.Config, builder *ReportBuilder, logger *slog.Logger, sqsClient *sqs.Client, maxConcurrency int) *Worker {
+func NewWorker(
+	cfg *config.Config,
+	builder *ReportBuilder,
+	reportsStore *store.ReportsStore,
+	logger *slog.Logger,
+	queue Queue,
+	deadLetterQueue *DeadLetterQueue,
+) *Worker {
+	concurrency := max(cfg.WorkerConcurrency, 1)
+	bufferSize := max(cfg.WorkerBufferSize, 0)
+	receiveBatchSize := min(max(cfg.WorkerReceiveBatchSize, 1), maxReceiveBatchSize)
+	receiveWaitTime := min(max(cfg.WorkerReceiveWaitTime, 0), maxReceiveWaitTime)
+	if receiveBatchSize != cfg.WorkerReceiveBatchSize || receiveWaitTime != cfg.WorkerReceiveWaitTime {
+		logger.Warn("clamped worker receive settings to queue limits",
+			"receive_batch_size", receiveBatchSize,
+			"receive_wait_time", receiveWaitTime,
+		)
+	}
+
 	return &Worker{
-		cfg:           cfg,
-		reportBuilder: builder,
-		logger:        logger,
-		sqsClient:     sqsClient,
-		sqsMsgChannel: make(chan types.Message, maxConcurrency),
-		concurrency:   maxConcurrency,
+		cfg:              cfg,
+		reportBuilder:    builder,
+		failures:         builder,
+		reportsStore:     reportsStore,
+		logger:           logger,
+		queue:            queue,
+		deadLetterQueue:  deadLetterQueue,
+		retryPolicy:      NewRetryPolicy(cfg),
+		msgChannel:       make(chan QueueMessage, bufferSize),
+		concurrency:      concurrency,
+		receiveBatchSize: receiveBatchSize,
+		receiveWaitTime:  receiveWaitTime,
 	}
 }
 
+// Start receives and processes jobs until ctx is cancelled, then drains: it
+// stops receiving, releases buffered messages back to the queue and waits up
+// to cfg.WorkerShutdownTimeout for in-flight builds before cancelling them.
 func (w *Worker) Start(ctx context.Context) error {
-	queueUrlOutput, err := w.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: aws.String(w.cfg.AWSSQSQueue),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get url for queue: %s: %w", w.cfg.AWSSQSQueue, err)
-	}
+	w.logger.Info("starting worker", "queue", w.cfg.AWSSQSQueue, "backend", w.cfg.QueueBackend)
 
-	w.logger.Info("starting worker", "queue", w.cfg.AWSSQSQueue, "queueUrl", queueUrlOutput.QueueUrl)
+	// Builds run on their own context so that cancelling ctx lets them finish.
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
 	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
 		go func(id int) {
+			defer wg.Done()
 			w.logger.Info(fmt.Sprintf("starting goroutine #%d", id))
 			for {
 				select {
 				case <-ctx.Done():
-					w.logger.Error("worker stopped", "goroutine_id", id, "error", ctx.Err())
+					w.logger.Info("worker goroutine stopped", "goroutine_id", id)
 					return
-				case message := <-w.sqsMsgChannel:
-					if err := w.processMessage(ctx, message); err != nil {
-						w.logger.Error("failed to process message", "goroutine_id", id, "error", err)
+				case message := <-w.msgChannel:
+					if ctx.Err() != nil {
+						w.release(jobCtx, message)
 						continue
 					}
-
-					if _, err := w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-						QueueUrl:      queueUrlOutput.QueueUrl,
-						ReceiptHandle: message.ReceiptHandle,
-					}); err != nil {
-						w.logger.Error("failed to delete message", "goroutine_id", id, "error", err)
-					}
+					w.handleMessage(jobCtx, id, message)
 				}
 			}
 		}(i)
 	}
 
-	for {
-		messageOutput, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            queueUrlOutput.QueueUrl,
-			MaxNumberOfMessages: int32(w.concurrency + 1),
-		})
-		if err != nil {
-			w.logger.Error("failed to receive message", "error", err)
-			if ctx.Err() != nil {
-				return ctx.Err()
+	w.receive(ctx)
+	w.logger.Info("draining worker", "timeout", w.cfg.WorkerShutdownTimeout)
+	for drained := false; !drained; {
+		select {
+		case message := <-w.msgChannel:
+			w.release(jobCtx, message)
+		default:
+			drained = true
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.logger.Info("worker drained")
+		return nil
+	case <-time.After(w.cfg.WorkerShutdownTimeout):
+		cancelJobs()
+		<-done
+		return fmt.Errorf("worker drain timed out after %s", w.cfg.WorkerShutdownTimeout)
+	}
+}
+
+func (w *Worker) receive(ctx context.Context) {
+	for ctx.Err() == nil {
+		// only take as many messages as can start soon, anything more would sit
+		// in the buffer with its visibility timeout running out
+		free := w.concurrency + cap(w.msgChannel) - int(w.busy.Load()) - len(w.msgChannel)
+		if free <= 0 {
+			if err := sleep(ctx, capacityPollInterval); err != nil {
+				return
 			}
+			continue
 		}
 
-		if len(messageOutput.Messages) == 0 {
+		messages, err := w.queue.Receive(ctx, min(free, w.receiveBatchSize), w.receiveWaitTime)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.Error("failed to receive message", "error", err)
+			if err := sleep(ctx, receiveErrorDelay); err != nil {
+				return
+			}
 			continue
 		}
 
-		for _, message := range messageOutput.Messages {
-			w.sqsMsgChannel <- message
+		for i, message := range messages {
+			select {
+			case w.msgChannel <- message:
+			case <-ctx.Done():
+				for _, message := range messages[i:] {
+					w.release(context.WithoutCancel(ctx), message)
+				}
+				return
+			}
 		}
 	}
 }
 
-func (w *Worker) processMessage(ctx context.Context, message types.Message) error {
-	w.logger.Info("processing message", "message_id", message.MessageId)
-	if message.Body == nil || *message.Body == "" {
-		return fmt.Errorf("message body is empty")
+func (w *Worker) handleMessage(ctx context.Context, id int, message QueueMessage) {
+	w.busy.Add(1)
+	defer w.busy.Add(-1)
+
+	stopHeartbeat := w.heartbeat(ctx, message)
+	report, err := w.processMessage(ctx, message)
+	stopHeartbeat()
+
+	// the message is settled even if the build was cancelled by a drain timeout
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		w.logger.Error("failed to process message", "goroutine_id", id, "message_id", message.Id, "error", err)
+		w.handleFailure(ctx, message, report, err)
+		return
+	}
+
+	if err := w.queue.Ack(ctx, message); err != nil {
+		w.logger.Error("failed to delete message", "goroutine_id", id, "error", err)
+	}
+}
+
+// release makes a message that was received but never started visible again
+// straight away, so another worker can pick it up.
+func (w *Worker) release(ctx context.Context, message QueueMessage) {
+	if err := w.queue.Nack(ctx, message, 0); err != nil {
+		w.logger.Error("failed to release message", "message_id", message.Id, "error", err)
+	}
+}
+
+func (w *Worker) processMessage(ctx context.Context, message QueueMessage) (*store.Report, error) {
+	w.logger.Info("processing message", "message_id", message.Id, "receive_count", message.ReceiveCount)
+	if len(message.Body) == 0 {
+		return nil, Permanent(fmt.Errorf("message body is empty"))
 	}
 
 	var sqsMessage SqsMessage
-	if err := json.Unmarshal([]byte(*message.Body), &sqsMessage); err != nil {
-		return err
+	if err := json.Unmarshal(message.Body, &sqsMessage); err != nil {
+		return nil, Permanent(err)
+	}
+
+	return w.reportBuilder.Build(ctx, sqsMessage)
+}
+
+// heartbeat keeps extending the visibility of message while its job runs, so
+// the queue does not hand it to another consumer. The returned func stops the
+// heartbeat and waits for it to exit, which must happen before the message is
+// acked or nacked.
+func (w *Worker) heartbeat(ctx context.Context, message QueueMessage) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(max(w.cfg.QueueVisibilityTimeout/3, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := w.queue.ExtendVisibility(ctx, message, w.cfg.QueueVisibilityTimeout)
+				if err != nil && ctx.Err() == nil {
+					w.logger.Warn("failed to extend message visibility", "message_id", message.Id, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
 	}
+}
 
-	if _, err := w.reportBuilder.Build(ctx, sqsMessage.UserId, sqsMessage.ReportId); err != nil {
-		return err
+// handleFailure either puts the job back on the queue with a backoff or, once
+// it has failed permanently or run out of attempts, fails its report and moves
+// it to the dead-letter queue. The attempt count is the larger of the queue's
+// receive count and the report's own counter, so neither a lost update nor a
+// recreated message resets the budget. This is the only place deciding whether
+// a failure is final.
+func (w *Worker) handleFailure(ctx context.Context, message QueueMessage, report *store.Report, cause error) {
+	attempts := message.ReceiveCount
+	if report != nil {
+		attempts = max(attempts, report.Attempts)
 	}
 
-	return nil
+	if w.retryPolicy.ShouldRetry(attempts, cause) {
+		if report != nil {
+			if err := w.failures.Requeue(ctx, report, cause); err != nil {
+				w.logger.Error("failed to requeue report", "report_id", report.Id, "error", err)
+				return
+			}
+		}
+
+		delay := w.retryPolicy.Delay(attempts)
+		if err := w.queue.Nack(ctx, message, delay); err != nil {
+			w.logger.Error("failed to release message", "message_id", message.Id, "error", err)
+			return
+		}
+		w.logger.Warn("retrying message", "message_id", message.Id, "attempts", attempts, "delay", delay)
+		return
+	}
+
+	if report != nil {
+		if err := w.failures.Fail(ctx, report, cause); err != nil {
+			w.logger.Error("failed to fail report", "report_id", report.Id, "error", err)
+		}
+	}
+
+	if err := w.deadLetterQueue.Put(ctx, message, attempts, cause); err != nil {
+		w.logger.Error("failed to dead-letter message", "message_id", message.Id, "error", err)
+		return
+	}
+	if err := w.queue.Ack(ctx, message); err != nil {
+		w.logger.Error("failed to delete message", "message_id", message.Id, "error", err)
+		return
+	}
+	w.logger.Warn("moved message to dead-letter queue", "message_id", message.Id, "attempts", attempts, "error", cause)
 }
@@ -0,0 +1,91 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WorkerStats are the signals a worker exposes for autoscaling.
+type WorkerStats struct {
+	Concurrency int `json:"concurrency"`
+	Busy        int `json:"busy"`
+	Buffered    int `json:"buffered"`
+	// Utilization is the share of goroutines processing a message.
+	Utilization float64 `json:"utilization"`
+	QueueDepth  int     `json:"queue_depth"`
+}
+
+func (w *Worker) Stats(ctx context.Context) (*WorkerStats, error) {
+	queueDepth, err := w.queue.Depth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	busy := int(w.busy.Load())
+	return &WorkerStats{
+		Concurrency: w.concurrency,
+		Busy:        busy,
+		Buffered:    len(w.msgChannel),
+		Utilization: float64(busy) / float64(w.concurrency),
+		QueueDepth:  queueDepth,
+	}, nil
+}
+
+// StartAdmin serves the worker admin endpoints until ctx is cancelled.
+func (w *Worker) StartAdmin(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ping", w.ping)
+	mux.HandleFunc("GET /stats", w.statsHandler)
+
+	httpServer := &http.Server{
+		Addr:    net.JoinHostPort(w.cfg.WorkerAdminHost, w.cfg.WorkerAdminPort),
+		Handler: mux,
+	}
+
+	go func() {
+		w.logger.Info("worker admin is running", "port", w.cfg.WorkerAdminPort)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.logger.Error("worker admin failed to listen and serve", "error", err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		shutdownCtx := context.Background()
+		shutdownCtx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			w.logger.Error("worker admin failed to shutdown", "error", err)
+		}
+	}()
+	wg.Wait()
+
+	return nil
+}
+
+func (w *Worker) ping(rw http.ResponseWriter, r *http.Request) {
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("pong"))
+}
+
+func (w *Worker) statsHandler(rw http.ResponseWriter, r *http.Request) {
+	stats, err := w.Stats(r.Context())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(rw).Encode(stats); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,195 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+func TestWorkerHandleFailure(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryQueue(time.Minute)
+	deadLetters := NewMemoryQueue(time.Minute)
+	worker := &Worker{
+		logger:          slog.Default(),
+		queue:           queue,
+		deadLetterQueue: NewDeadLetterQueue(deadLetters),
+		retryPolicy:     RetryPolicy{MaxAttempts: 2},
+	}
+
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	messages, err := queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+
+	// a transient failure puts the job back on the queue
+	worker.handleFailure(ctx, messages[0], nil, errors.New("compendium unavailable"))
+	messages, err = queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, 2, messages[0].ReceiveCount)
+	require.Equal(t, 0, deadLetters.Len())
+
+	// until it runs out of attempts
+	worker.handleFailure(ctx, messages[0], nil, errors.New("compendium unavailable"))
+	require.Equal(t, 0, queue.Len())
+	require.Equal(t, 1, deadLetters.Len())
+
+	// a permanent failure is dead-lettered straight away
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	messages, err = queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+	worker.handleFailure(ctx, messages[0], nil, Permanent(ErrUnknownReportType))
+	require.Equal(t, 0, queue.Len())
+	require.Equal(t, 2, deadLetters.Len())
+}
+
+type recordedFailures struct {
+	requeued []uuid.UUID
+	failed   []uuid.UUID
+}
+
+func (r *recordedFailures) Requeue(ctx context.Context, report *store.Report, cause error) error {
+	r.requeued = append(r.requeued, report.Id)
+	return nil
+}
+
+func (r *recordedFailures) Fail(ctx context.Context, report *store.Report, cause error) error {
+	r.failed = append(r.failed, report.Id)
+	return nil
+}
+
+func TestWorkerHandleFailureRecordsReport(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryQueue(time.Minute)
+	deadLetters := NewMemoryQueue(time.Minute)
+	failures := &recordedFailures{}
+	worker := &Worker{
+		logger:          slog.Default(),
+		queue:           queue,
+		deadLetterQueue: NewDeadLetterQueue(deadLetters),
+		failures:        failures,
+		retryPolicy:     RetryPolicy{MaxAttempts: 3},
+	}
+
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	messages, err := queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+
+	// a retried failure only requeues the report
+	retried := &store.Report{Id: uuid.New(), Attempts: 1}
+	worker.handleFailure(ctx, messages[0], retried, errors.New("compendium unavailable"))
+	require.Equal(t, []uuid.UUID{retried.Id}, failures.requeued)
+	require.Empty(t, failures.failed)
+	require.Equal(t, 0, deadLetters.Len())
+
+	// a message received more often than its report was claimed, e.g. after a
+	// drain released it, is out of attempts even though the report is not
+	messages[0].ReceiveCount = 3
+	final := &store.Report{Id: uuid.New(), Attempts: 1}
+	worker.handleFailure(ctx, messages[0], final, errors.New("compendium unavailable"))
+	require.Equal(t, []uuid.UUID{final.Id}, failures.failed)
+	require.Len(t, failures.requeued, 1)
+	require.Equal(t, 1, deadLetters.Len())
+}
+
+func TestWorkerHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	visibilityTimeout := 60 * time.Millisecond
+	queue := NewMemoryQueue(visibilityTimeout)
+	worker := &Worker{
+		cfg:    &config.Config{QueueVisibilityTimeout: visibilityTimeout},
+		logger: slog.Default(),
+		queue:  queue,
+	}
+
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	messages, err := queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+
+	stopHeartbeat := worker.heartbeat(ctx, messages[0])
+	redelivered, err := queue.Receive(ctx, 1, 4*visibilityTimeout)
+	require.NoError(t, err)
+	require.Empty(t, redelivered)
+
+	stopHeartbeat()
+	redelivered, err = queue.Receive(ctx, 1, time.Second)
+	require.NoError(t, err)
+	require.Len(t, redelivered, 1)
+	require.Equal(t, 2, redelivered[0].ReceiveCount)
+}
+
+func TestWorkerDrainReleasesBufferedMessages(t *testing.T) {
+	queue := NewMemoryQueue(time.Minute)
+	worker := &Worker{
+		cfg:              &config.Config{WorkerShutdownTimeout: time.Second},
+		logger:           slog.Default(),
+		queue:            queue,
+		msgChannel:       make(chan QueueMessage, 2),
+		receiveBatchSize: 10,
+		receiveWaitTime:  time.Second,
+	}
+
+	for range 3 {
+		require.NoError(t, queue.Send(context.Background(), []byte("{}")))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- worker.Start(ctx)
+	}()
+
+	// with no goroutines to process them, only two messages fit in the buffer
+	require.Eventually(t, func() bool { return len(worker.msgChannel) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	messages, err := queue.Receive(context.Background(), 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+}
+
+func TestNewWorkerClampsReceiveSettings(t *testing.T) {
+	worker := NewWorker(&config.Config{
+		WorkerConcurrency:      16,
+		WorkerBufferSize:       4,
+		WorkerReceiveBatchSize: 50,
+		WorkerReceiveWaitTime:  time.Minute,
+	}, nil, nil, slog.Default(), NewMemoryQueue(time.Minute), nil)
+
+	require.Equal(t, 16, worker.concurrency)
+	require.Equal(t, 4, cap(worker.msgChannel))
+	require.Equal(t, 10, worker.receiveBatchSize)
+	require.Equal(t, 20*time.Second, worker.receiveWaitTime)
+}
+
+func TestWorkerStats(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryQueue(time.Minute)
+	worker := NewWorker(&config.Config{WorkerConcurrency: 4}, nil, nil, slog.Default(), queue, nil)
+
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	require.NoError(t, queue.Send(ctx, []byte("{}")))
+	worker.busy.Add(1)
+
+	rec := httptest.NewRecorder()
+	worker.statsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{
+		"concurrency": 4,
+		"busy": 1,
+		"buffered": 0,
+		"utilization": 0.25,
+		"queue_depth": 2
+	}`, rec.Body.String())
+}
@@ -1,17 +1,29 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
 
+	"report-generation/db/store"
 	"report-generation/reports"
 )
 
@@ -31,8 +43,9 @@ func (r SignupRequest) Validate() error {
 }
 
 type ApiResponse[T any] struct {
-	Data    *T     `json:"data,omitempty"`
-	Message string `json:"message,omitempty"`
+	Data       *T     `json:"data,omitempty"`
+	Message    string `json:"message,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 func (s *Server) signupHandler(w http.ResponseWriter, r *http.Request) {
@@ -256,7 +269,9 @@ func (s *Server) tokenRefreshHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type CreateReportRequest struct {
-	ReportType string `json:"reportType"`
+	ReportType   string             `json:"reportType"`
+	OutputFormat string             `json:"outputFormat"`
+	Parameters   reports.Parameters `json:"parameters"`
 }
 
 func (r CreateReportRequest) Validate() error {
@@ -267,17 +282,49 @@ func (r CreateReportRequest) Validate() error {
 }
 
 type ApiReport struct {
-	Id                   uuid.UUID  `json:"id"`
-	ReportType           string     `json:"reportType,omitempty"`
-	OutputFilePath       *string    `json:"outputFilePath,omitempty"`
-	DownloadUrl          *string    `json:"downloadUrl,omitempty"`
-	DownloadUrlExpiresAt *time.Time `json:"downloadUrlExpiresAt,omitempty"`
-	ErrorMessage         *string    `json:"errorMessage,omitempty"`
-	CreatedAt            time.Time  `json:"createdAt,omitempty"`
-	StartedAt            *time.Time `json:"startedAt,omitempty"`
-	FailedAt             *time.Time `json:"failedAt,omitempty"`
-	CompletedAt          *time.Time `json:"completedAt,omitempty"`
-	Status               string     `json:"status,omitempty"`
+	Id                   uuid.UUID       `json:"id"`
+	ReportType           string          `json:"reportType,omitempty"`
+	OutputFormat         string          `json:"outputFormat,omitempty"`
+	Parameters           json.RawMessage `json:"parameters,omitempty"`
+	OutputFilePath       *string         `json:"outputFilePath,omitempty"`
+	DownloadUrl          *string         `json:"downloadUrl,omitempty"`
+	DownloadUrlExpiresAt *time.Time      `json:"downloadUrlExpiresAt,omitempty"`
+	ErrorMessage         *string         `json:"errorMessage,omitempty"`
+	CreatedAt            time.Time       `json:"createdAt,omitempty"`
+	StartedAt            *time.Time      `json:"startedAt,omitempty"`
+	FailedAt             *time.Time      `json:"failedAt,omitempty"`
+	CompletedAt          *time.Time      `json:"completedAt,omitempty"`
+	CancelledAt          *time.Time      `json:"cancelledAt,omitempty"`
+	RetryCount           int             `json:"retryCount,omitempty"`
+	Status               string          `json:"status,omitempty"`
+}
+
+func newApiReport(report *store.Report) *ApiReport {
+	return &ApiReport{
+		Id:                   report.Id,
+		ReportType:           report.ReportType,
+		OutputFormat:         report.OutputFormat,
+		Parameters:           report.Parameters,
+		OutputFilePath:       report.OutputFilePath,
+		DownloadUrl:          report.DownloadUrl,
+		DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
+		ErrorMessage:         report.ErrorMessage,
+		CreatedAt:            report.CreatedAt,
+		StartedAt:            report.StartedAt,
+		FailedAt:             report.FailedAt,
+		CompletedAt:          report.CompletedAt,
+		CancelledAt:          report.CancelledAt,
+		RetryCount:           report.RetryCount,
+		Status:               report.Status(),
+	}
+}
+
+type ApiReportError struct {
+	RetryCount   int        `json:"retryCount"`
+	Attempts     int        `json:"attempts"`
+	ErrorMessage *string    `json:"errorMessage,omitempty"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FailedAt     time.Time  `json:"failedAt"`
 }
 
 func (s *Server) createReportHandler(w http.ResponseWriter, r *http.Request) {
@@ -295,71 +342,203 @@ func (s *Server) createReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	generator, err := s.reportRegistry.Lookup(req.ReportType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Parameters.Validate(reports.ColumnsFor(generator, req.Parameters.Game)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parameters, err := json.Marshal(req.Parameters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.OutputFormat == "" {
+		req.OutputFormat = reports.DefaultOutputFormat
+	}
+
+	if _, err := s.reportRegistry.LookupEncoder(req.OutputFormat); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	user, ok := UserFromContext(ctx)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	report, err := s.store.ReportsStore.CreateReport(ctx, user.Id, req.ReportType)
+	report, err := s.store.ReportsStore.CreateReportAndEnqueue(ctx, user.Id, req.ReportType, req.OutputFormat, parameters, reports.NewJobMessage)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	sqsMessage := reports.SqsMessage{
-		UserId:   report.UserId,
-		ReportId: report.Id,
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+}
+
+func (s *Server) getReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ttl, err := s.presignTTL(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	bytes, err := json.Marshal(sqsMessage)
+	report, err := s.store.ReportsStore.GetReportByPrimaryKey(ctx, user.Id, reportId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	queueUrlOutput, err := s.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
-		QueueName: aws.String(s.cfg.AWSSQSQueue),
-	})
+	if report.Status() == "completed" && report.OutputFilePath != nil {
+		downloadUrl, err := s.presignOutputFile(ctx, report, ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.DownloadUrl = &downloadUrl.url
+		report.DownloadUrlExpiresAt = &downloadUrl.expiresAt
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+}
+
+func (s *Server) cancelReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report, cancelled, err := s.store.ReportsStore.CancelReport(ctx, user.Id, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	_, err = s.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		MessageBody: aws.String(string(bytes)),
-		QueueUrl:    queueUrlOutput.QueueUrl,
-	})
+	if !cancelled {
+		http.Error(w, fmt.Sprintf("report is already %s", report.Status()), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiReport]{
+			Data: newApiReport(report),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) retryReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report, retried, err := s.store.ReportsStore.RetryReport(ctx, user.Id, reportId, reports.NewJobMessage)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if !retried {
+		http.Error(w, fmt.Sprintf("report is %s, only failed reports can be retried", report.Status()), http.StatusConflict)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusAccepted)
 	if err := json.NewEncoder(w).
 		Encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				FailedAt:             report.FailedAt,
-				CompletedAt:          report.CompletedAt,
-				Status:               report.Status(),
-			},
+			Data: newApiReport(report),
 		}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
 
+type ApiReportProgress struct {
+	Id    uuid.UUID `json:"id"`
+	Stage string    `json:"stage"`
 }
 
-func (s *Server) getReportHandler(w http.ResponseWriter, r *http.Request) {
+// reportEventsHandler streams the status of a report as server-sent events,
+// one event per status change named after the status plus progress events
+// while it is processing, and ends the stream once the report is done.
+func (s *Server) reportEventsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	reportIdStr := r.PathValue("id")
@@ -375,33 +554,348 @@ func (s *Server) getReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// subscribe before loading the report so no transition falls in between
+	events, unsubscribe := s.reportEvents.Subscribe(reportId)
+	defer unsubscribe()
+
 	report, err := s.store.ReportsStore.GetReportByPrimaryKey(ctx, user.Id, reportId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	send := func(event string, data any) bool {
+		if err := writeServerSentEvent(w, event, data); err != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+
+	status := report.Status()
+	if !send(status, newApiReport(report)) || report.IsDone() {
+		return
+	}
+
+	// refresh reloads the report and sends its status when it has changed. It
+	// returns false once the stream should end.
+	refresh := func() bool {
+		report, err := s.store.ReportsStore.GetReportByPrimaryKey(ctx, user.Id, reportId)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				s.logger.Error("failed to reload report", "report_id", reportId, "error", err)
+			}
+			return false
+		}
+		if report.Status() == status {
+			return true
+		}
+		status = report.Status()
+		return send(status, newApiReport(report)) && !report.IsDone()
+	}
+
+	// the keep-alive also reloads the report, in case an event was missed
+	ticker := time.NewTicker(s.cfg.SSEKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Event == store.ReportEventProgress {
+				if event.UserId == user.Id && status == "processing" &&
+					!send(event.Event, ApiReportProgress{Id: reportId, Stage: event.Stage}) {
+					return
+				}
+				continue
+			}
+			if !refresh() {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil || controller.Flush() != nil {
+				return
+			}
+			if !refresh() {
+				return
+			}
+		}
+	}
+}
+
+func writeServerSentEvent(w io.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func (s *Server) getReportErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := s.store.ReportsStore.GetReportByPrimaryKey(ctx, user.Id, reportId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	needsNewDownloadUrl := report.DownloadUrl == nil || (report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.Before(time.Now()))
-	if report.CompletedAt != nil && needsNewDownloadUrl {
-		expiresAt := time.Now().Add(10 * time.Second)
-		object, err := s.s3PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(s.cfg.AWSS3Bucket),
-			Key:    report.OutputFilePath,
-		}, func(options *s3.PresignOptions) {
-			options.Expires = 10 * time.Second
+	reportErrors, err := s.store.ReportsStore.ListReportErrors(ctx, user.Id, reportId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiReportErrors := make([]ApiReportError, 0, len(reportErrors))
+	for _, reportError := range reportErrors {
+		apiReportErrors = append(apiReportErrors, ApiReportError{
+			RetryCount:   reportError.RetryCount,
+			Attempts:     reportError.Attempts,
+			ErrorMessage: reportError.ErrorMessage,
+			StartedAt:    reportError.StartedAt,
+			FailedAt:     reportError.FailedAt,
 		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[[]ApiReportError]{
+			Data: &apiReportErrors,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+const (
+	defaultListReportsLimit = 20
+	maxListReportsLimit     = 100
+)
+
+func (s *Server) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseListReportsFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userReports, nextCursor, err := s.store.ReportsStore.ListReports(ctx, user.Id, *filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiReports := make([]ApiReport, 0, len(userReports))
+	for _, report := range userReports {
+		apiReports = append(apiReports, *newApiReport(&report))
+	}
+
+	var encodedCursor string
+	if nextCursor != nil {
+		encodedCursor, err = encodeReportsCursor(nextCursor)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		report.DownloadUrl = &object.URL
-		report.DownloadUrlExpiresAt = &expiresAt
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[[]ApiReport]{
+			Data:       &apiReports,
+			NextCursor: encodedCursor,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func parseListReportsFilter(query url.Values) (*store.ListReportsFilter, error) {
+	filter := &store.ListReportsFilter{
+		ReportType: query.Get("reportType"),
+		Limit:      defaultListReportsLimit,
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxListReportsLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxListReportsLimit)
+		}
+		filter.Limit = limit
+	}
 
-		report, err = s.store.ReportsStore.UpdateReport(ctx, report)
+	for _, statuses := range query["status"] {
+		for _, status := range strings.Split(statuses, ",") {
+			if !slices.Contains(store.ReportStatuses, status) {
+				return nil, fmt.Errorf("status must be one of: %s", strings.Join(store.ReportStatuses, ", "))
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTimeParam(query, "createdAfter"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedBefore, err = parseTimeParam(query, "createdBefore"); err != nil {
+		return nil, err
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeReportsCursor(cursor)
 		if err != nil {
+			return nil, errors.New("cursor is invalid")
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+func encodeReportsCursor(cursor *store.ReportsCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeReportsCursor(encoded string) (*store.ReportsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor store.ReportsCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (s *Server) deleteReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report, err := s.store.ReportsStore.DeleteReport(ctx, user.Id, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.deleteReportOutputFile(ctx, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type DeleteReportsResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func (s *Server) deleteReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	olderThan, err := parseTimeParam(r.URL.Query(), "olderThan")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if olderThan == nil {
+		http.Error(w, "olderThan is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := s.store.ReportsStore.DeleteReportsOlderThan(ctx, user.Id, *olderThan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, report := range deleted {
+		if err := s.deleteReportOutputFile(ctx, &report); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -410,23 +904,194 @@ func (s *Server) getReportHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).
-		Encode(ApiResponse[ApiReport]{
-			Data: &ApiReport{
-				Id:                   report.Id,
-				ReportType:           report.ReportType,
-				OutputFilePath:       report.OutputFilePath,
-				DownloadUrl:          report.DownloadUrl,
-				DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
-				ErrorMessage:         report.ErrorMessage,
-				CreatedAt:            report.CreatedAt,
-				StartedAt:            report.StartedAt,
-				FailedAt:             report.FailedAt,
-				CompletedAt:          report.CompletedAt,
-				Status:               report.Status(),
+		Encode(ApiResponse[DeleteReportsResponse]{
+			Data: &DeleteReportsResponse{
+				Deleted: len(deleted),
 			},
 		}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// deleteReportOutputFile removes the report's file from S3, treating a file
+// that is already gone as deleted, and then forgets its path.
+func (s *Server) deleteReportOutputFile(ctx context.Context, report *store.Report) error {
+	if report.OutputFilePath == nil {
+		return nil
+	}
+
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.AWSS3Bucket),
+		Key:    report.OutputFilePath,
+	})
+	var noSuchKey *types.NoSuchKey
+	if err != nil && !errors.As(err, &noSuchKey) {
+		return fmt.Errorf("failed to delete object %s: %w", *report.OutputFilePath, err)
+	}
+
+	return s.store.ReportsStore.ClearOutputFile(ctx, report.UserId, report.Id)
+}
+
+const (
+	DownloadModeProxy    = "proxy"
+	DownloadModeRedirect = "redirect"
+)
+
+func (s *Server) downloadReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportIdStr := r.PathValue("id")
+	reportId, err := uuid.Parse(reportIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report, err := s.store.ReportsStore.GetReportByPrimaryKey(ctx, user.Id, reportId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if report.Status() != "completed" || report.OutputFilePath == nil {
+		http.Error(w, fmt.Sprintf("report is %s, only completed reports can be downloaded", report.Status()), http.StatusConflict)
+		return
+	}
+
+	if s.cfg.ReportDownloadMode == DownloadModeRedirect {
+		ttl, err := s.presignTTL(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		downloadUrl, err := s.presignOutputFile(ctx, report, ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, downloadUrl.url, http.StatusFound)
+		return
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.AWSS3Bucket),
+		Key:    report.OutputFilePath,
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+	if ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		input.IfModifiedSince = aws.Time(ifModifiedSince)
+	}
+
+	object, err := s.s3Client.GetObject(ctx, input)
+	if err != nil {
+		var responseErr *awshttp.ResponseError
+		if errors.As(err, &responseErr) {
+			switch responseErr.HTTPStatusCode() {
+			case http.StatusNotModified:
+				w.WriteHeader(http.StatusNotModified)
+				return
+			case http.StatusRequestedRangeNotSatisfiable:
+				http.Error(w, "requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+				return
+			case http.StatusNotFound:
+				http.Error(w, "report file not found", http.StatusNotFound)
+				return
+			}
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer object.Body.Close()
+
+	writeReportFileHeaders(w.Header(), report, object)
+	if object.ContentRange != nil {
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if _, err := io.Copy(w, object.Body); err != nil {
+		s.logger.Error("failed to stream report file", "report_id", report.Id, "error", err)
+	}
+}
+
+func writeReportFileHeaders(header http.Header, report *store.Report, object *s3.GetObjectOutput) {
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": fmt.Sprintf("%s-%s", report.ReportType, path.Base(*report.OutputFilePath)),
+	}))
+	if object.ContentType != nil {
+		header.Set("Content-Type", *object.ContentType)
+	}
+	if object.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	if object.ContentRange != nil {
+		header.Set("Content-Range", *object.ContentRange)
+	}
+	if object.ETag != nil {
+		header.Set("ETag", *object.ETag)
+	}
+	if object.LastModified != nil {
+		header.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// presignOutputFile returns a presigned URL for the report's file that stays
+// valid for ttl, reusing a cached one while enough of its lifetime is left.
+func (s *Server) presignOutputFile(ctx context.Context, report *store.Report, ttl time.Duration) (presignedUrl, error) {
+	if cached, ok := s.presignCache.Get(*report.OutputFilePath, ttl); ok {
+		return cached, nil
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	object, err := s.s3PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.AWSS3Bucket),
+		Key:    report.OutputFilePath,
+	}, func(options *s3.PresignOptions) {
+		options.Expires = ttl
+	})
+	if err != nil {
+		return presignedUrl{}, err
+	}
+
+	presigned := presignedUrl{url: object.URL, expiresAt: expiresAt}
+	s.presignCache.Set(*report.OutputFilePath, ttl, presigned)
+	return presigned, nil
+}
+
+// presignTTL reads the optional ttl query parameter, given in seconds or as a
+// duration such as 30m, and caps it at cfg.PresignMaxTTL.
+func (s *Server) presignTTL(query url.Values) (time.Duration, error) {
+	value := query.Get("ttl")
+	if value == "" {
+		return min(s.cfg.PresignTTL, s.cfg.PresignMaxTTL), nil
+	}
+
+	invalidErr := errors.New("ttl must be a positive number of seconds or a duration")
+	var ttl time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		ttl = time.Duration(seconds) * time.Second
+	} else if ttl, err = time.ParseDuration(value); err != nil {
+		return 0, invalidErr
+	}
+	if ttl <= 0 {
+		return 0, invalidErr
+	}
+	return min(ttl, s.cfg.PresignMaxTTL), nil
 }
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+	"report-generation/db/store"
+	"report-generation/reports"
+)
+
+func TestParseListReportsFilter(t *testing.T) {
+	filter, err := parseListReportsFilter(url.Values{})
+	require.NoError(t, err)
+	require.Equal(t, &store.ListReportsFilter{Limit: defaultListReportsLimit}, filter)
+
+	cursor, err := encodeReportsCursor(&store.ReportsCursor{
+		CreatedAt: time.Date(2024, 11, 3, 10, 0, 0, 123456000, time.UTC),
+		Id:        uuid.MustParse("8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77"),
+	})
+	require.NoError(t, err)
+
+	filter, err = parseListReportsFilter(url.Values{
+		"status":        {"failed,cancelled", "completed"},
+		"reportType":    {"monsters"},
+		"createdAfter":  {"2024-11-01T00:00:00Z"},
+		"createdBefore": {"2024-12-01T00:00:00Z"},
+		"order":         {"asc"},
+		"limit":         {"5"},
+		"cursor":        {cursor},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"failed", "cancelled", "completed"}, filter.Statuses)
+	require.Equal(t, "monsters", filter.ReportType)
+	require.Equal(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), *filter.CreatedAfter)
+	require.Equal(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), *filter.CreatedBefore)
+	require.True(t, filter.Ascending)
+	require.Equal(t, 5, filter.Limit)
+	require.Equal(t, "8c3a4a3e-6f31-4b8f-9b2e-0f8d2b1c5a77", filter.After.Id.String())
+	require.True(t, time.Date(2024, 11, 3, 10, 0, 0, 123456000, time.UTC).Equal(filter.After.CreatedAt))
+
+	for _, query := range []url.Values{
+		{"status": {"done"}},
+		{"limit": {"0"}},
+		{"limit": {"1000"}},
+		{"createdAfter": {"yesterday"}},
+		{"order": {"sideways"}},
+		{"cursor": {"not-a-cursor"}},
+	} {
+		_, err := parseListReportsFilter(query)
+		require.Error(t, err, query)
+	}
+}
+
+func TestCreateReportHandlerRejectsInvalidRequests(t *testing.T) {
+	s := &Server{reportRegistry: reports.NewDefaultRegistry()}
+
+	for _, tc := range []struct {
+		name  string
+		body  string
+		error string
+	}{
+		{"malformed body", `{"reportType":`, "unexpected EOF"},
+		{"missing report type", `{}`, "reportType is required"},
+		{"unknown report type", `{"reportType": "dungeons"}`, "dungeons"},
+		{"unsupported output format", `{"reportType": "monsters", "outputFormat": "pdf"}`, "pdf"},
+	} {
+		recorder := httptest.NewRecorder()
+		s.createReportHandler(recorder, httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(tc.body)))
+		require.Equal(t, http.StatusBadRequest, recorder.Code, tc.name)
+		require.Contains(t, recorder.Body.String(), tc.error, tc.name)
+	}
+}
+
+func TestWriteReportFileHeaders(t *testing.T) {
+	lastModified := time.Date(2024, 11, 3, 10, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		outputFilePath string
+		contentType    string
+		filename       string
+	}{
+		{"/users/8c3a4a3e/report/0f8d2b1c.csv.gz", "application/gzip", "monsters-0f8d2b1c.csv.gz"},
+		{"/users/8c3a4a3e/report/0f8d2b1c.json.gz", "application/gzip", "monsters-0f8d2b1c.json.gz"},
+		{"/users/8c3a4a3e/report/0f8d2b1c.ndjson.gz", "application/gzip", "monsters-0f8d2b1c.ndjson.gz"},
+		{"/users/8c3a4a3e/report/0f8d2b1c.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "monsters-0f8d2b1c.xlsx"},
+	} {
+		report := &store.Report{ReportType: "monsters", OutputFilePath: &tc.outputFilePath}
+
+		header := http.Header{}
+		writeReportFileHeaders(header, report, &s3.GetObjectOutput{
+			ContentType:   aws.String(tc.contentType),
+			ContentLength: aws.Int64(100),
+			ContentRange:  aws.String("bytes 0-99/2048"),
+			ETag:          aws.String(`"abc"`),
+			LastModified:  &lastModified,
+		})
+
+		// compressed reports are gzip files, clients must not decompress them
+		require.Equal(t, http.Header{
+			"Accept-Ranges":       {"bytes"},
+			"Content-Disposition": {"attachment; filename=" + tc.filename},
+			"Content-Type":        {tc.contentType},
+			"Content-Length":      {"100"},
+			"Content-Range":       {"bytes 0-99/2048"},
+			"Etag":                {`"abc"`},
+			"Last-Modified":       {"Sun, 03 Nov 2024 10:00:00 GMT"},
+		}, header, tc.outputFilePath)
+	}
+}
+
+func TestPresignTTL(t *testing.T) {
+	s := &Server{cfg: &config.Config{PresignTTL: 15 * time.Minute, PresignMaxTTL: time.Hour}}
+
+	for value, expected := range map[string]time.Duration{
+		"":    15 * time.Minute,
+		"90":  90 * time.Second,
+		"30m": 30 * time.Minute,
+		"24h": time.Hour,
+	} {
+		ttl, err := s.presignTTL(url.Values{"ttl": {value}})
+		require.NoError(t, err, value)
+		require.Equal(t, expected, ttl, value)
+	}
+
+	for _, value := range []string{"0", "-5", "soon"} {
+		_, err := s.presignTTL(url.Values{"ttl": {value}})
+		require.Error(t, err, value)
+	}
+}
+
+func TestWriteServerSentEvent(t *testing.T) {
+	var buffer bytes.Buffer
+	err := writeServerSentEvent(&buffer, "progress", ApiReportProgress{Id: uuid.Nil, Stage: "fetching"})
+	require.NoError(t, err)
+	require.Equal(t, "event: progress\ndata: {\"id\":\"00000000-0000-0000-0000-000000000000\",\"stage\":\"fetching\"}\n\n", buffer.String())
+}
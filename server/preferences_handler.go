@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"report-generation/db/store"
+)
+
+type UpdatePreferencesRequest struct {
+	EmailNotifications *bool `json:"emailNotifications"`
+}
+
+func (r UpdatePreferencesRequest) Validate() error {
+	if r.EmailNotifications == nil {
+		return errors.New("emailNotifications is required")
+	}
+	return nil
+}
+
+type ApiPreferences struct {
+	EmailNotifications bool       `json:"emailNotifications"`
+	UpdatedAt          *time.Time `json:"updatedAt,omitempty"`
+}
+
+func newApiPreferences(preferences *store.UserPreferences) *ApiPreferences {
+	return &ApiPreferences{
+		EmailNotifications: preferences.EmailNotifications,
+		UpdatedAt:          preferences.UpdatedAt,
+	}
+}
+
+func (s *Server) getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := s.store.PreferencesStore.GetUserPreferences(ctx, user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiPreferences]{
+			Data: newApiPreferences(preferences),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req UpdatePreferencesRequest
+	OneMb := int64(1048576)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, OneMb)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := s.store.PreferencesStore.UpsertUserPreferences(ctx, &store.UserPreferences{
+		UserId:             user.Id,
+		EmailNotifications: *req.EmailNotifications,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiPreferences]{
+			Data: newApiPreferences(preferences),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const maxPresignCacheEntries = 10000
+
+type presignedUrl struct {
+	url       string
+	expiresAt time.Time
+}
+
+type presignCacheKey struct {
+	objectKey string
+	ttl       time.Duration
+}
+
+// presignCache keeps presigned URLs in memory so reading a report neither
+// presigns on every request nor writes the URL back to the database. A cached
+// URL is reused while at least half of its lifetime is left.
+type presignCache struct {
+	mu      sync.Mutex
+	entries map[presignCacheKey]presignedUrl
+	now     func() time.Time
+}
+
+func newPresignCache() *presignCache {
+	return &presignCache{
+		entries: make(map[presignCacheKey]presignedUrl),
+		now:     time.Now,
+	}
+}
+
+func (c *presignCache) Get(objectKey string, ttl time.Duration) (presignedUrl, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[presignCacheKey{objectKey, ttl}]
+	if !ok || entry.expiresAt.Sub(c.now()) < ttl/2 {
+		return presignedUrl{}, false
+	}
+	return entry, true
+}
+
+func (c *presignCache) Set(objectKey string, ttl time.Duration, entry presignedUrl) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxPresignCacheEntries {
+		now := c.now()
+		for key, cached := range c.entries {
+			if cached.expiresAt.Before(now) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxPresignCacheEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[presignCacheKey{objectKey, ttl}] = entry
+}
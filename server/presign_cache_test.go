@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresignCache(t *testing.T) {
+	now := time.Now()
+	cache := newPresignCache()
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.Get("report.csv", time.Minute)
+	require.False(t, ok)
+
+	cache.Set("report.csv", time.Minute, presignedUrl{url: "https://s3/report.csv", expiresAt: now.Add(time.Minute)})
+	cached, ok := cache.Get("report.csv", time.Minute)
+	require.True(t, ok)
+	require.Equal(t, "https://s3/report.csv", cached.url)
+
+	// a URL for another lifetime is presigned separately
+	_, ok = cache.Get("report.csv", time.Hour)
+	require.False(t, ok)
+
+	now = now.Add(29 * time.Second)
+	_, ok = cache.Get("report.csv", time.Minute)
+	require.True(t, ok)
+
+	// less than half of the lifetime is left
+	now = now.Add(2 * time.Second)
+	_, ok = cache.Get("report.csv", time.Minute)
+	require.False(t, ok)
+}
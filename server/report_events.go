@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+const (
+	reportEventsMinReconnect = time.Second
+	reportEventsMaxReconnect = time.Minute
+	reportEventsPingInterval = 90 * time.Second
+	reportEventsBufferSize   = 16
+)
+
+// ReportEventBroker listens for report events on Postgres and fans them out to
+// the subscribers of each report. After the listener reconnects, notifications
+// sent while it was down are lost, so every subscriber receives an event with
+// an empty Event to tell it to reload the report.
+type ReportEventBroker struct {
+	cfg         *config.Config
+	logger      *slog.Logger
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan store.ReportEvent]struct{}
+	closed      bool
+}
+
+func NewReportEventBroker(cfg *config.Config, logger *slog.Logger) *ReportEventBroker {
+	return &ReportEventBroker{
+		cfg:         cfg,
+		logger:      logger,
+		subscribers: make(map[uuid.UUID]map[chan store.ReportEvent]struct{}),
+	}
+}
+
+func (b *ReportEventBroker) Start(ctx context.Context) error {
+	listener := pq.NewListener(b.cfg.DBUrl, reportEventsMinReconnect, reportEventsMaxReconnect,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				b.logger.Warn("report events listener error", "event", event, "error", err)
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(store.ReportEventsChannel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", store.ReportEventsChannel, err)
+	}
+
+	ticker := time.NewTicker(reportEventsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification := <-listener.Notify:
+			if notification == nil {
+				b.resync()
+				continue
+			}
+			var event store.ReportEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				b.logger.Warn("failed to unmarshal report event", "payload", notification.Extra, "error", err)
+				continue
+			}
+			b.publish(event)
+		case <-ticker.C:
+			if err := listener.Ping(); err != nil {
+				b.logger.Warn("failed to ping report events listener", "error", err)
+			}
+		}
+	}
+}
+
+// Subscribe returns the events of a report until the returned function is
+// called. The channel is closed when the broker is closed.
+func (b *ReportEventBroker) Subscribe(reportId uuid.UUID) (<-chan store.ReportEvent, func()) {
+	events := make(chan store.ReportEvent, reportEventsBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(events)
+		return events, func() {}
+	}
+	if b.subscribers[reportId] == nil {
+		b.subscribers[reportId] = make(map[chan store.ReportEvent]struct{})
+	}
+	b.subscribers[reportId][events] = struct{}{}
+
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[reportId], events)
+		if len(b.subscribers[reportId]) == 0 {
+			delete(b.subscribers, reportId)
+		}
+	}
+}
+
+// Close closes the channel of every subscriber, so open event streams end
+// instead of holding up the server's shutdown.
+func (b *ReportEventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for reportId, subscribers := range b.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+		delete(b.subscribers, reportId)
+	}
+}
+
+func (b *ReportEventBroker) publish(event store.ReportEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for events := range b.subscribers[event.ReportId] {
+		b.send(events, event)
+	}
+}
+
+func (b *ReportEventBroker) resync() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for reportId, subscribers := range b.subscribers {
+		for events := range subscribers {
+			b.send(events, store.ReportEvent{ReportId: reportId})
+		}
+	}
+}
+
+// send never blocks the listener on a slow subscriber. Dropping an event is
+// safe because subscribers reload the report on the next one.
+func (b *ReportEventBroker) send(events chan store.ReportEvent, event store.ReportEvent) {
+	select {
+	case events <- event:
+	default:
+		b.logger.Warn("dropped report event for slow subscriber", "report_id", event.ReportId, "event", event.Event)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"report-generation/config"
+	"report-generation/db/store"
+)
+
+func TestReportEventBroker(t *testing.T) {
+	broker := NewReportEventBroker(&config.Config{}, slog.Default())
+
+	reportId, otherReportId := uuid.New(), uuid.New()
+	events, unsubscribe := broker.Subscribe(reportId)
+	otherEvents, unsubscribeOther := broker.Subscribe(otherReportId)
+	defer unsubscribeOther()
+
+	broker.publish(store.ReportEvent{ReportId: reportId, Event: "processing"})
+	require.Equal(t, store.ReportEvent{ReportId: reportId, Event: "processing"}, <-events)
+	require.Empty(t, otherEvents)
+
+	broker.resync()
+	require.Equal(t, store.ReportEvent{ReportId: reportId}, <-events)
+	require.Equal(t, store.ReportEvent{ReportId: otherReportId}, <-otherEvents)
+
+	// a slow subscriber loses events instead of blocking the listener
+	for range reportEventsBufferSize + 1 {
+		broker.publish(store.ReportEvent{ReportId: reportId, Event: store.ReportEventProgress})
+	}
+	require.Len(t, events, reportEventsBufferSize)
+
+	unsubscribe()
+	require.NotContains(t, broker.subscribers, reportId)
+	require.Contains(t, broker.subscribers, otherReportId)
+
+	// closing ends every stream, including ones subscribed afterwards
+	broker.Close()
+	for range otherEvents {
+	}
+	lateEvents, unsubscribeLate := broker.Subscribe(reportId)
+	defer unsubscribeLate()
+	_, ok := <-lateEvents
+	require.False(t, ok)
+	require.Empty(t, broker.subscribers)
+}
@@ -10,10 +10,10 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
 	"report-generation/config"
 	"report-generation/db/store"
+	"report-generation/reports"
 )
 
 type Server struct {
@@ -21,8 +21,11 @@ type Server struct {
 	logger          *slog.Logger
 	store           *store.Store
 	jwtManager      *JwtManager
-	sqsClient       *sqs.Client
+	s3Client        *s3.Client
 	s3PresignClient *s3.PresignClient
+	presignCache    *presignCache
+	reportRegistry  *reports.Registry
+	reportEvents    *ReportEventBroker
 }
 
 func New(
@@ -30,16 +33,21 @@ func New(
 	logger *slog.Logger,
 	store *store.Store,
 	jwtManager *JwtManager,
-	sqsClient *sqs.Client,
+	s3Client *s3.Client,
 	s3PresignClient *s3.PresignClient,
+	reportRegistry *reports.Registry,
+	reportEvents *ReportEventBroker,
 ) *Server {
 	return &Server{
 		cfg:             cfg,
 		logger:          logger,
 		store:           store,
 		jwtManager:      jwtManager,
-		sqsClient:       sqsClient,
+		s3Client:        s3Client,
 		s3PresignClient: s3PresignClient,
+		presignCache:    newPresignCache(),
+		reportRegistry:  reportRegistry,
+		reportEvents:    reportEvents,
 	}
 }
 
@@ -50,7 +58,24 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("POST /auth/signin", s.signinHandler)
 	mux.HandleFunc("POST /auth/refresh", s.tokenRefreshHandler)
 	mux.HandleFunc("POST /reports", s.createReportHandler)
+	mux.HandleFunc("GET /reports", s.listReportsHandler)
+	mux.HandleFunc("DELETE /reports", s.deleteReportsHandler)
 	mux.HandleFunc("GET /reports/{id}", s.getReportHandler)
+	mux.HandleFunc("DELETE /reports/{id}", s.deleteReportHandler)
+	mux.HandleFunc("GET /reports/{id}/download", s.downloadReportHandler)
+	mux.HandleFunc("GET /reports/{id}/events", s.reportEventsHandler)
+	mux.HandleFunc("POST /reports/{id}/cancel", s.cancelReportHandler)
+	mux.HandleFunc("POST /reports/{id}/retry", s.retryReportHandler)
+	mux.HandleFunc("GET /reports/{id}/errors", s.getReportErrorsHandler)
+	mux.HandleFunc("GET /preferences", s.getPreferencesHandler)
+	mux.HandleFunc("PATCH /preferences", s.updatePreferencesHandler)
+	mux.HandleFunc("POST /webhooks", s.createWebhookHandler)
+	mux.HandleFunc("GET /webhooks", s.listWebhooksHandler)
+	mux.HandleFunc("GET /webhooks/{id}", s.getWebhookHandler)
+	mux.HandleFunc("PATCH /webhooks/{id}", s.updateWebhookHandler)
+	mux.HandleFunc("DELETE /webhooks/{id}", s.deleteWebhookHandler)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", s.listWebhookDeliveriesHandler)
+	mux.HandleFunc("POST /webhooks/{id}/deliveries/{deliveryId}/redeliver", s.redeliverWebhookHandler)
 
 	middleware := NewLoggerMiddleware(s.logger)
 	middleware = NewAuthMiddleware(s.logger, s.jwtManager, s.store.Users)
@@ -59,6 +84,8 @@ func (s *Server) Start(ctx context.Context) error {
 		Addr:    net.JoinHostPort(s.cfg.ServerHost, s.cfg.ServerPort),
 		Handler: middleware(mux),
 	}
+	// event streams only end when the client leaves, so Shutdown would wait for them
+	httpServer.RegisterOnShutdown(s.reportEvents.Close)
 
 	go func() {
 		s.logger.Info("server is running", "port", s.cfg.ServerPort)
@@ -0,0 +1,444 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"report-generation/db/store"
+)
+
+const (
+	defaultListDeliveriesLimit = 20
+	maxListDeliveriesLimit     = 100
+)
+
+type CreateWebhookRequest struct {
+	Url string `json:"url"`
+}
+
+func (r CreateWebhookRequest) Validate() error {
+	return validateWebhookUrl(r.Url)
+}
+
+type UpdateWebhookRequest struct {
+	Url          *string `json:"url"`
+	Enabled      *bool   `json:"enabled"`
+	RotateSecret bool    `json:"rotateSecret"`
+}
+
+func (r UpdateWebhookRequest) Validate() error {
+	if r.Url != nil {
+		return validateWebhookUrl(*r.Url)
+	}
+	return nil
+}
+
+func validateWebhookUrl(rawUrl string) error {
+	if rawUrl == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+	return nil
+}
+
+// ApiWebhook only carries the secret in the responses that generate it.
+type ApiWebhook struct {
+	Id        uuid.UUID `json:"id"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func newApiWebhook(webhook *store.Webhook) *ApiWebhook {
+	return &ApiWebhook{
+		Id:        webhook.Id,
+		Url:       webhook.Url,
+		Enabled:   webhook.Enabled,
+		CreatedAt: webhook.CreatedAt,
+		UpdatedAt: webhook.UpdatedAt,
+	}
+}
+
+type ApiWebhookDelivery struct {
+	Id             uuid.UUID       `json:"id"`
+	ReportId       uuid.UUID       `json:"reportId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt,omitempty"`
+	ResponseStatus *int            `json:"responseStatus,omitempty"`
+	LastError      *string         `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	FailedAt       *time.Time      `json:"failedAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+func newApiWebhookDelivery(delivery *store.WebhookDelivery) *ApiWebhookDelivery {
+	apiDelivery := &ApiWebhookDelivery{
+		Id:             delivery.Id,
+		ReportId:       delivery.ReportId,
+		Event:          delivery.Event,
+		Payload:        delivery.Payload,
+		Status:         delivery.Status(),
+		Attempts:       delivery.Attempts,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		FailedAt:       delivery.FailedAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	if delivery.Status() == "pending" {
+		apiDelivery.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return apiDelivery
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (s *Server) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req CreateWebhookRequest
+	OneMb := int64(1048576)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, OneMb)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	webhook, err := s.store.WebhookStore.CreateWebhook(ctx, user.Id, req.Url, secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiWebhook := newApiWebhook(webhook)
+	apiWebhook.Secret = webhook.Secret
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiWebhook]{
+			Data: apiWebhook,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := s.store.WebhookStore.ListWebhooks(ctx, user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiWebhooks := make([]ApiWebhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		apiWebhooks = append(apiWebhooks, *newApiWebhook(&webhook))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[[]ApiWebhook]{
+			Data: &apiWebhooks,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhookIdStr := r.PathValue("id")
+	webhookId, err := uuid.Parse(webhookIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	webhook, err := s.store.WebhookStore.GetWebhook(ctx, user.Id, webhookId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiWebhook]{
+			Data: newApiWebhook(webhook),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhookIdStr := r.PathValue("id")
+	webhookId, err := uuid.Parse(webhookIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateWebhookRequest
+	OneMb := int64(1048576)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, OneMb)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	webhook, err := s.store.WebhookStore.GetWebhook(ctx, user.Id, webhookId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Url != nil {
+		webhook.Url = *req.Url
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	if req.RotateSecret {
+		webhook.Secret, err = newWebhookSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	webhook, err = s.store.WebhookStore.UpdateWebhook(ctx, webhook)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiWebhook := newApiWebhook(webhook)
+	if req.RotateSecret {
+		apiWebhook.Secret = webhook.Secret
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiWebhook]{
+			Data: apiWebhook,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhookIdStr := r.PathValue("id")
+	webhookId, err := uuid.Parse(webhookIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.store.WebhookStore.DeleteWebhook(ctx, user.Id, webhookId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhookIdStr := r.PathValue("id")
+	webhookId, err := uuid.Parse(webhookIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultListDeliveriesLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxListDeliveriesLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxListDeliveriesLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := s.store.WebhookStore.GetWebhook(ctx, user.Id, webhookId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := s.store.WebhookStore.ListDeliveries(ctx, user.Id, webhookId, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiDeliveries := make([]ApiWebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		apiDeliveries = append(apiDeliveries, *newApiWebhookDelivery(&delivery))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[[]ApiWebhookDelivery]{
+			Data: &apiDeliveries,
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// redeliverWebhookHandler queues a new delivery of an earlier delivery's
+// payload. It is sent with a fresh retry budget by the worker's dispatcher.
+func (s *Server) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	webhookIdStr := r.PathValue("id")
+	webhookId, err := uuid.Parse(webhookIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deliveryIdStr := r.PathValue("deliveryId")
+	deliveryId, err := uuid.Parse(deliveryIdStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	delivery, err := s.store.WebhookStore.Redeliver(ctx, user.Id, webhookId, deliveryId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).
+		Encode(ApiResponse[ApiWebhookDelivery]{
+			Data: newApiWebhookDelivery(delivery),
+		}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
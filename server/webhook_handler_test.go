@@ -0,0 +1,16 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateWebhookUrl(t *testing.T) {
+	for _, rawUrl := range []string{"https://example.com/hooks", "http://localhost:8080/reports"} {
+		require.NoError(t, validateWebhookUrl(rawUrl), rawUrl)
+	}
+	for _, rawUrl := range []string{"", "example.com/hooks", "ftp://example.com", "https://", "://bad"} {
+		require.Error(t, validateWebhookUrl(rawUrl), rawUrl)
+	}
+}
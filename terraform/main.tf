@@ -14,6 +14,10 @@ variable "aws_sqs_queue" {
   type = string
 }
 
+variable "aws_sqs_dead_letter_queue" {
+  type = string
+}
+
 variable "aws_s3_bucket" {
   type = string
 }
@@ -54,4 +58,9 @@ resource "aws_sqs_queue" "reports-sqs-queue" {
   message_retention_seconds = 86400
   receive_wait_time_seconds = 10
 
-}
\ No newline at end of file
+}
+
+resource "aws_sqs_queue" "reports-sqs-dead-letter-queue" {
+  name                      = var.aws_sqs_dead_letter_queue
+  message_retention_seconds = 1209600
+}